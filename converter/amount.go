@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// maxAmount bounds the magnitude of any single parsed amount. Anything
+// larger is treated as a corrupt export value rather than a real movement.
+var maxAmount = big.NewFloat(1e30)
+
+// parseAmount parses a K33 amount string exactly. It rejects non-finite
+// values (such as "Inf" or "1e400" overflowing a float64) and values whose
+// magnitude exceeds maxAmount.
+func parseAmount(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+
+	// Check the magnitude with big.Float first: it handles huge exponents
+	// cheaply, whereas big.Rat would expand them into an exact integer.
+	f, _, err := big.ParseFloat(s, 10, 64, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	if f.IsInf() {
+		return nil, fmt.Errorf("non-finite amount %q", s)
+	}
+	if new(big.Float).Abs(f).Cmp(maxAmount) > 0 {
+		return nil, fmt.Errorf("amount %q out of range", s)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return r, nil
+}
+
+// maxDecimals caps the fractional digits formatAmount will render.
+const maxDecimals = 36
+
+// formatAmount renders r as a plain decimal string with no trailing zeros.
+func formatAmount(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	for prec := 1; prec < maxDecimals; prec++ {
+		s := r.FloatString(prec)
+		if exact, ok := new(big.Rat).SetString(s); ok && exact.Cmp(r) == 0 {
+			return s
+		}
+	}
+	return r.FloatString(maxDecimals)
+}
+
+// currencySymbols maps amount prefixes to the asset they denote.
+var currencySymbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+	"¥": "JPY",
+}
+
+// stripCurrencySymbol removes a known currency symbol prefix (after an
+// optional sign) from amount, along with its thousands separators, so
+// "-$1,000.50" becomes "-1000.50" with currency "USD". ok is false when
+// amount carries no known symbol.
+func stripCurrencySymbol(amount string) (stripped, currency string, ok bool) {
+	amount = strings.TrimSpace(amount)
+	sign := ""
+	if strings.HasPrefix(amount, "-") {
+		sign, amount = "-", amount[1:]
+	}
+	for symbol, cur := range currencySymbols {
+		if rest, found := strings.CutPrefix(amount, symbol); found {
+			return sign + strings.ReplaceAll(strings.TrimSpace(rest), ",", ""), cur, true
+		}
+	}
+	return "", "", false
+}
+
+// amountPrefix matches the numeric part at the start of an amount cell,
+// including thousands separators and grouping spaces.
+var amountPrefix = regexp.MustCompile(`^[-+]?(?:\d[\d, ]*(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// stripAnnotation removes trailing non-numeric text such as " (est)" or
+// "%" from amount, warning when it does. Only text starting with something
+// other than a digit, "." or "," is an annotation, so separators such as
+// "1 000.50" or "1.000,50" are left for normalizeAmount to accept or
+// reject. Values with no numeric prefix are returned unchanged so amount
+// validation rejects them.
+func (c *Converter) stripAnnotation(amount string) string {
+	trimmed := strings.TrimSpace(amount)
+	prefix := amountPrefix.FindString(trimmed)
+	number := strings.TrimSpace(prefix)
+	rest := strings.TrimSpace(trimmed[len(prefix):])
+	if number == "" || rest == "" || strings.ContainsAny(rest[:1], "0123456789.,") {
+		return amount
+	}
+	c.warnf("Ignoring annotation %q on amount %q", rest, amount)
+	return number
+}
+
+// thousandsGrouped matches a number whose integer part is grouped in
+// thousands with commas, e.g. "1,000.50".
+var thousandsGrouped = regexp.MustCompile(`^[-+]?\d{1,3}(?:,\d{3})+(?:\.\d*)?$`)
+
+// normalizeAmount rewrites an exported amount as a canonical decimal:
+// spaces and thousands separators are removed and scientific notation is
+// expanded, keeping the sign. Amounts that still do not parse (including
+// ambiguous commas such as "1,5") are returned unchanged, so
+// validateAmounts rejects the row.
+func normalizeAmount(amount string) string {
+	s := strings.ReplaceAll(strings.TrimSpace(amount), " ", "")
+	if thousandsGrouped.MatchString(s) {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	r, err := parseAmount(s)
+	if err != nil {
+		return amount
+	}
+	return formatAmount(r)
+}
+
+// isZeroAmount reports whether s parses to exactly zero.
+func isZeroAmount(s string) bool {
+	if s == "" {
+		return false
+	}
+	r, err := parseAmount(s)
+	return err == nil && r.Sign() == 0
+}
+
+// validateAmounts checks every non-empty amount on a K33 row.
+func validateAmounts(k33 K33Record) error {
+	for _, amount := range []string{k33.Amount, k33.Fee, k33.GrossAmount, k33.NetAmount} {
+		if amount == "" {
+			continue
+		}
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"1000", "1000", false},
+		{"-0.5", "-1/2", false},
+		{"1.5e3", "1500", false},
+		{"1e400", "", true},
+		{"1e308", "", true},
+		{"Inf", "", true},
+		{"NaN", "", true},
+		{"abc", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := parseAmount(test.input)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseAmount(%s) = %s, want error", test.input, got.RatString())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAmount(%s) returned error: %v", test.input, err)
+			continue
+		}
+		if got.RatString() != test.want {
+			t.Errorf("parseAmount(%s) = %s, want %s", test.input, got.RatString(), test.want)
+		}
+	}
+}
+
+func TestAbsurdAmountIsSkipped(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,1e400,BTC,2023/01/15 10:30:45
+Deposit Complete,1,BTC,2023/01/16 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ReceivedAmount != "1" {
+		t.Errorf("Expected only the valid deposit, got %+v", records)
+	}
+	for _, r := range records {
+		if strings.Contains(r.ReceivedAmount, "Inf") || strings.Contains(r.ReceivedAmount, "NaN") {
+			t.Errorf("Non-finite amount leaked into output: %+v", r)
+		}
+	}
+}
+
+func TestStripCurrencySymbol(t *testing.T) {
+	tests := []struct {
+		input        string
+		wantAmount   string
+		wantCurrency string
+		wantOK       bool
+	}{
+		{"$1,000.50", "1000.50", "USD", true},
+		{"-€250", "-250", "EUR", true},
+		{"1000.50", "", "", false},
+	}
+
+	for _, test := range tests {
+		amount, currency, ok := stripCurrencySymbol(test.input)
+		if amount != test.wantAmount || currency != test.wantCurrency || ok != test.wantOK {
+			t.Errorf("stripCurrencySymbol(%s) = %q, %q, %v, want %q, %q, %v",
+				test.input, amount, currency, ok, test.wantAmount, test.wantCurrency, test.wantOK)
+		}
+	}
+}
+
+func TestCurrencySymbolAmountInfersAsset(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,"$1,000.50",,2023/01/15 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	if records[0].ReceivedAmount != "1000.5" || records[0].ReceivedCurrency != "USD" {
+		t.Errorf("Deposit = %s %s, want 1000.5 USD", records[0].ReceivedAmount, records[0].ReceivedCurrency)
+	}
+}
+
+func TestNormalizeAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1,000.50", "1000.5"},
+		{"-1,234,567", "-1234567"},
+		{" 2.5 ", "2.5"},
+		{"1 000", "1000"},
+		{"1.5e-3", "0.0015"},
+		{"-0.50", "-0.5"},
+		// Unparseable or ambiguous values are left for validateAmounts
+		{"1,5", "1,5"},
+		{"12,34.5", "12,34.5"},
+		{"n/a", "n/a"},
+	}
+	for _, test := range tests {
+		if got := normalizeAmount(test.input); got != test.expected {
+			t.Errorf("normalizeAmount(%q) = %q, want %q", test.input, got, test.expected)
+		}
+	}
+
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,"1,000.50",USD,2023/01/15 10:30:45
+Withdrawal Complete,-2E-2,BTC,2023/01/16 10:30:45
+Deposit Complete,"1,5",EUR,2023/01/17 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the ambiguous amount to be skipped, got %d records", len(records))
+	}
+	if records[0].ReceivedAmount != "1000.5" || records[1].SentAmount != "0.02" {
+		t.Errorf("Amounts = %s, %s, want 1000.5, 0.02", records[0].ReceivedAmount, records[1].SentAmount)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1000", "1000"},
+		{"0.0015", "0.0015"},
+		{"1.50", "1.5"},
+		{"-2.25", "-2.25"},
+	}
+
+	for _, test := range tests {
+		r, err := parseAmount(test.input)
+		if err != nil {
+			t.Fatalf("parseAmount(%s) returned error: %v", test.input, err)
+		}
+		if result := formatAmount(r); result != test.expected {
+			t.Errorf("formatAmount(%s) = %s, want %s", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestStripAnnotation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0.5 (est)", "0.5"},
+		{"100%", "100"},
+		{"-2.5e3 approx", "-2.5e3"},
+		{"1000", "1000"},
+		{"1 000.50", "1 000.50"},
+		{"1.000,50", "1.000,50"},
+		{"1,000.50 (est)", "1,000.50"},
+		{"n/a", "n/a"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if result := New().stripAnnotation(test.input); result != test.expected {
+			t.Errorf("stripAnnotation(%q) = %q, want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestAnnotatedAmounts(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,0.5 (est),BTC,2023/01/15 10:30:45
+Deposit Complete,n/a,BTC,2023/01/16 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected the n/a row to be rejected, got %d records", len(records))
+	}
+	if records[0].ReceivedAmount != "0.5" {
+		t.Errorf("ReceivedAmount = %q, want 0.5", records[0].ReceivedAmount)
+	}
+}
+
+func TestSeparatedAmountsEndToEnd(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,1 000.50,USD,2023/01/15 10:30:45
+Deposit Complete,"1,000.50 (est)",USD,2023/01/16 10:30:45
+Deposit Complete,"1.000,50",EUR,2023/01/17 10:30:45`
+
+	conv := New()
+	conv.LogLevel = LogQuiet
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the ambiguous 1.000,50 row to be rejected, got %+v", records)
+	}
+	for i, r := range records {
+		if r.ReceivedAmount != "1000.5" {
+			t.Errorf("record %d ReceivedAmount = %q, want 1000.5", i, r.ReceivedAmount)
+		}
+	}
+}
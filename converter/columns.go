@@ -0,0 +1,74 @@
+package converter
+
+import (
+	"maps"
+	"strings"
+)
+
+// defaultDirectionValues maps Direction column values, in lower case, to
+// "in" or "out" for exports that give an unsigned amount and a direction.
+var defaultDirectionValues = map[string]string{
+	"in":       "in",
+	"incoming": "in",
+	"credit":   "in",
+	"out":      "out",
+	"outgoing": "out",
+	"debit":    "out",
+}
+
+// DefaultDirectionValues returns a copy of the built-in Direction values,
+// for extending Converter.DirectionValues.
+func DefaultDirectionValues() map[string]string {
+	return maps.Clone(defaultDirectionValues)
+}
+
+// cleanColumn strips the UTF-8 BOM and surrounding whitespace K33 exports
+// may carry on column names.
+func cleanColumn(col string) string {
+	return strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))
+}
+
+// mapHeader returns header with each column cleaned and renamed to its
+// canonical K33 name according to c.Columns.
+func (c *Converter) mapHeader(header []string) []string {
+	source := make(map[string]string, len(c.Columns))
+	for canonical, col := range c.Columns {
+		source[col] = canonical
+	}
+
+	mapped := make([]string, len(header))
+	for i, col := range header {
+		col = cleanColumn(col)
+		if canonical, ok := source[col]; ok {
+			col = canonical
+		}
+		mapped[i] = col
+	}
+	return mapped
+}
+
+// direction resolves a row's Direction value to "in", "out" or "".
+func (c *Converter) direction(k33 K33Record) string {
+	values := c.DirectionValues
+	if values == nil {
+		values = defaultDirectionValues
+	}
+	return values[strings.ToLower(strings.TrimSpace(k33.Direction))]
+}
+
+// typeFromSign infers the Type/Status of an untyped row from its amount's
+// sign: "Deposit" when positive, "Withdrawal" when negative, and "" (the
+// row is skipped) when zero or unparseable.
+func typeFromSign(amount string) string {
+	r, err := parseAmount(amount)
+	if err != nil {
+		return ""
+	}
+	switch r.Sign() {
+	case 1:
+		return "Deposit"
+	case -1:
+		return "Withdrawal"
+	}
+	return ""
+}
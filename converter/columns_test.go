@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapHeader(t *testing.T) {
+	conv := New()
+	conv.Columns = map[string]string{"Amount": "Qty", "Asset": "Currency"}
+
+	mapped := conv.mapHeader([]string{"\ufeffType/Status", " Qty ", "Currency", "Timestamp (UTC)"})
+	expected := []string{"Type/Status", "Amount", "Asset", "Timestamp (UTC)"}
+	for i := range expected {
+		if mapped[i] != expected[i] {
+			t.Errorf("mapHeader()[%d] = %q, want %q", i, mapped[i], expected[i])
+		}
+	}
+}
+
+func TestDirectionColumnLayout(t *testing.T) {
+	input := `Kind,Qty,Direction,Currency,Timestamp (UTC)
+Transfer,0.25,out,BTC,2023/01/15 10:30:45
+Transfer,100,In,USD,2023/01/16 10:30:45`
+
+	conv := New()
+	conv.Columns = map[string]string{"Type/Status": "Kind", "Amount": "Qty", "Asset": "Currency"}
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].SentAmount != "0.25" || records[0].SentCurrency != "BTC" || records[0].ReceivedAmount != "" {
+		t.Errorf("Direction out should produce a sent row, got %+v", records[0])
+	}
+	if records[1].ReceivedAmount != "100" || records[1].ReceivedCurrency != "USD" {
+		t.Errorf("Direction in should produce a received row, got %+v", records[1])
+	}
+}
+
+func TestDirectionSetsTradeSide(t *testing.T) {
+	input := `Type/Status,TradeID,Direction,Amount,Asset,Timestamp (UTC)
+Trade,5,debit,0.5,BTC,2023/01/15 10:30:45
+Trade,5,credit,1000,USD,2023/01/15 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].SentCurrency != "BTC" || records[0].ReceivedCurrency != "USD" {
+		t.Errorf("Expected BTC->USD trade from directions, got %+v", records)
+	}
+}
+
+func TestInferTypeFromSign(t *testing.T) {
+	input := `Change,Asset,Timestamp (UTC)
+0.5,BTC,2023/01/15 10:30:45
+-0.2,BTC,2023/01/16 10:30:45
+0,BTC,2023/01/17 10:30:45`
+
+	if _, err := New().parseRecords(strings.NewReader(input)); err == nil {
+		t.Fatal("want a missing Type/Status error without InferTypeFromSign")
+	}
+
+	conv := New()
+	conv.InferTypeFromSign = true
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if r := records[0]; r.ReceivedAmount != "0.5" || r.ReceivedCurrency != "BTC" || r.SentAmount != "" {
+		t.Errorf("positive change = %+v, want a 0.5 BTC deposit", r)
+	}
+	if r := records[1]; r.SentAmount != "0.2" || r.SentCurrency != "BTC" || r.ReceivedAmount != "" {
+		t.Errorf("negative change = %+v, want a 0.2 BTC withdrawal", r)
+	}
+	if conv.stats.Skipped != 1 {
+		t.Errorf("Skipped = %d, want 1 (the zero change)", conv.stats.Skipped)
+	}
+}
@@ -1,133 +1,828 @@
 package converter
 
 import (
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Converter struct {
-	trades map[string]*TradePair
+	// LogLevel selects which diagnostics are logged: LogWarnings (the
+	// zero value), LogQuiet or LogVerbose.
+	LogLevel LogLevel
+
+	// TeeJSON, when set, receives every written record as one JSON
+	// object per line alongside the CSV output.
+	TeeJSON io.Writer
+
+	// StrictDepositStatus only imports deposits whose status is in
+	// finalDepositStatuses; anything else is treated as pending and skipped.
+	StrictDepositStatus bool
+
+	// SkipDeposits, SkipWithdrawals and SkipTrades drop whole record
+	// categories from the output.
+	SkipDeposits    bool
+	SkipWithdrawals bool
+	SkipTrades      bool
+
+	// NoTrim keeps the whitespace and BOM around data cells, which are
+	// otherwise trimmed like the header's column names.
+	NoTrim bool
+
+	// Color colorizes ProcessDryRun lines by record type.
+	Color bool
+
+	// Format selects how Process encodes records; New defaults to
+	// FormatCSV.
+	Format Format
+
+	// Target selects the output CSV layout; New defaults to TargetKoinly.
+	Target Target
+
+	// InDelimiter and OutDelimiter are the field separators of the K33
+	// input (and pending files) and of the CSV output; zero means a comma.
+	InDelimiter  rune
+	OutDelimiter rune
+
+	// BOM starts the CSV output with a UTF-8 byte order mark, so Excel
+	// reads non-ASCII text correctly. Koinly's importer does not want one.
+	BOM bool
+
+	// WithSeq adds a leading "Seq" column numbering rows from 1 in output
+	// order.
+	WithSeq bool
+
+	// OutputOrder selects the final record order; New defaults to
+	// OrderInput.
+	OutputOrder OutputOrder
+
+	// Reverse writes newest dates first; on its own it sorts by date.
+	Reverse bool
+
+	// MaxBuffer caps how many records are held in memory while sorting
+	// (an OutputOrder other than OrderInput, or Reverse); past it, sorted
+	// runs are spilled to temp files and merged at the end. Zero means no
+	// cap.
+	MaxBuffer int
+
+	// Tag is written to an extra "Tag" column on every row, unless
+	// TagsByAsset has a tag for one of the row's currencies.
+	Tag         string
+	TagsByAsset map[string]string
+
+	// ZeroFillAmounts writes "0" instead of an empty cell for the Sent,
+	// Received and Fee amounts of the CSV output.
+	ZeroFillAmounts bool
+
+	// Transforms rewrites output cells, keyed by column name of the Target
+	// header; see CheckTransforms.
+	Transforms map[string]Transform
+
+	// Daily truncates every output Date to midnight. Rows from the same
+	// day keep their relative order.
+	Daily bool
+
+	// FiatCurrencies lists the upper-case tickers treated as fiat, which
+	// are rounded to FiatPrecision, anchor trade sides and are told apart
+	// from crypto in deposit and withdrawal descriptions; nil uses
+	// fiatCurrencies.
+	FiatCurrencies map[string]bool
+
+	// FiatPrecision is the number of decimals fiat values are rounded to;
+	// negative disables rounding. New defaults it to 2.
+	FiatPrecision int
+
+	// RoundAmounts also rounds Sent, Received and Fee amounts: fiat ones
+	// to FiatPrecision and the rest to CryptoPrecision decimals, which New
+	// defaults to 8.
+	RoundAmounts    bool
+	CryptoPrecision int
+
+	// FiatValueCurrency is the currency of Fiat Value cells that name
+	// none, neither by symbol nor in a Fiat Currency column; New defaults
+	// it to USD. Trades take their net worth from the buy fills' values.
+	FiatValueCurrency string
+
+	// BaseFiat, when set, is the fiat currency every other fiat amount is
+	// converted into, using the daily rates in FiatRates.
+	BaseFiat  string
+	FiatRates FiatRates
+
+	// DescLine appends the input line numbers a record was converted from
+	// to its Description, e.g. "[lines 3, 4]" for a trade's two legs.
+	DescLine bool
+
+	// MaxDescription truncates descriptions to this many characters when
+	// positive. MaxDescriptionByType overrides it per record type
+	// ("deposit", "withdrawal", "trade", "transfer", "fork", "staking",
+	// "reward", "interest", "adjustment").
+	MaxDescription       int
+	MaxDescriptionByType map[string]int
+
+	// Descriptions replaces the built-in description of a record type
+	// (keyed like MaxDescriptionByType) with a template; see describe for
+	// its placeholders.
+	Descriptions map[string]string
+
+	// MinFee drops fees below a threshold, keyed by fee currency. The ""
+	// key applies to currencies without their own entry.
+	MinFee map[string]*big.Rat
+
+	// UnitDivisors converts amounts exported in a smallest unit (satoshis,
+	// wei) to whole coins, keyed by asset.
+	UnitDivisors map[string]*big.Rat
+
+	// Currencies, when set, lists the valid output currency symbols.
+	// Unknown ones are warned about, or fail conversion with
+	// StrictCurrencies.
+	Currencies       CurrencyRegistry
+	StrictCurrencies bool
+
+	// FeeCurrency is the currency given to trade fees exported without
+	// one: FeeCurrencySell (the default, K33's usual behavior),
+	// FeeCurrencyBuy, or a fixed currency symbol.
+	FeeCurrency string
+
+	// NetFee subtracts a fee paid in the received currency from the
+	// received amount instead of reporting it as a separate fee.
+	NetFee bool
+
+	// FeeReport, when set, receives a CSV of total fees per currency.
+	FeeReport io.Writer
+
+	// DailySummary, when set, receives a CSV of the amounts received, sent
+	// and paid in fees per asset and day, for reconciling against daily
+	// exchange statements.
+	DailySummary io.Writer
+
+	// HumanOut, when set, receives a readable copy of the output with
+	// amounts rendered as "$1000" or "0.5 BTC", for sharing rather than
+	// importing.
+	HumanOut io.Writer
+
+	// MergeWindow, when positive, pairs orphan buy and sell legs whose
+	// trade ids nearly match and whose timestamps are this close.
+	MergeWindow time.Duration
+
+	// Prices, when set, is used to rebuild the quote leg of trades whose
+	// export contains only one leg.
+	Prices PriceTable
+
+	// Columns renames export columns to the canonical K33 names used by
+	// the parser, keyed by canonical name (e.g. "Amount": "Qty").
+	Columns map[string]string
+
+	// DirectionValues maps Direction column values (lower case) to "in"
+	// or "out"; nil uses defaultDirectionValues.
+	DirectionValues map[string]string
+
+	// InferTypeFromSign treats rows with no Type/Status as a deposit when
+	// their amount is positive and a withdrawal when it is negative, for
+	// minimal exports with only a signed Change (or Amount) and an asset.
+	InferTypeFromSign bool
+
+	// RejectStatuses lists the Trade Status values (lower case) whose rows
+	// are skipped; nil uses defaultRejectStatuses.
+	RejectStatuses map[string]bool
+
+	// AssertColumns, when set to a schema version (or "latest"), fails
+	// the conversion unless the header matches that K33 schema exactly.
+	AssertColumns string
+
+	// SkipLines discards this many lines before looking for the header.
+	// Metadata lines above the header are also detected automatically.
+	SkipLines int
+
+	// StartOffset resumes conversion at the first record starting at or
+	// after this byte offset into the input. The header is still read from
+	// the top of the input.
+	StartOffset int64
+
+	// Location is the time zone output dates are converted to from the
+	// export's UTC timestamps; nil means UTC.
+	Location *time.Location
+
+	// Since, when positive, drops rows older than Since before Now.
+	Since time.Duration
+
+	// From and To, when set, drop rows dated before From or after To
+	// (inclusive, by date in the output time zone). Only their dates are
+	// used.
+	From, To time.Time
+
+	// Assets, when set, restricts output to records sending or receiving
+	// one of these upper-case symbols.
+	Assets map[string]bool
+
+	// ZeroLegPolicy controls trades where one leg has a zero amount.
+	ZeroLegPolicy ZeroLegPolicy
+
+	// SignConvention is the sign layout of trade leg amounts, used to warn
+	// about legs signed against it; New defaults to SignOpposite. Amounts
+	// are converted to absolute values whatever the convention.
+	SignConvention SignConvention
+
+	// AmountBasis picks the gross or net amount of deposits and
+	// withdrawals exported with both; New defaults to AmountBasisNet. The
+	// fee between them is kept either way.
+	AmountBasis AmountBasis
+
+	// TradeTime picks the leg whose timestamp dates a trade; New defaults
+	// to TradeTimeLatest, which does not depend on the order of the legs.
+	TradeTime TradeTime
+
+	// Now is the clock used for relative filters; New sets it to time.Now.
+	Now func() time.Time
+
+	// PendingOut, when set, receives the legs of trades left unpaired at
+	// end of input, for a later run to load with LoadPending.
+	PendingOut io.Writer
+
+	// VerboseStats, when set, receives a CSV of the count, min, median
+	// and max sent or received amount per asset.
+	VerboseStats io.Writer
+
+	// MaxErrors, when not negative, is how many bad rows (malformed CSV
+	// rows, invalid amounts and rejects) a conversion tolerates before
+	// failing with a *TooManyErrors. Malformed rows are only skipped under
+	// a budget; otherwise they fail the conversion. New defaults to -1, no
+	// budget. Read errors always fail.
+	MaxErrors int
+
+	// InternalTransfers merges a withdrawal and a deposit of one currency
+	// sharing a reference id (or TxHash), exported next to each other, into
+	// a single transfer row, for moves between the user's own sub-accounts.
+	InternalTransfers bool
+
+	// Dedup drops records identical to one already written, for exports
+	// that overlap at their boundaries. Records with a TxHash are compared
+	// on it alone, others on their date, amounts and currencies.
+	Dedup bool
+
+	// Strict fails the conversion with an *UnpairedTrades error when any
+	// trade is left unpaired, instead of only warning.
+	Strict bool
+
+	// ExplainUnpaired, when set, receives a dump of each trade left
+	// unpaired at end of input: which side is present, with its fields.
+	ExplainUnpaired io.Writer
+
+	// RejectsReport, when set, receives a CSV of the input rows left out
+	// of the output, in the original K33 columns plus a Reason, e.g.
+	// "rejected status", "empty timestamp" or "unpaired trade".
+	RejectsReport io.Writer
+
+	// UnrecognizedReport, when set, receives a CSV of Type/Status values
+	// the converter does not handle, with a count and sample row for each.
+	UnrecognizedReport io.Writer
+
+	header            []string
+	trades            map[string]*TradePair
+	filled            string         // trade with both sides, open for further fills
+	carried           []KoinlyRecord // completed while loading pending trades
+	seeded            bool           // trades loaded by LoadPending for the next conversion
+	skippedDeposits   int
+	droppedFees       int
+	unrecognized      map[string]*unrecognizedType
+	uniqueKeys        map[string][]string // UniqueKey -> record types using it
+	rejects           []Reject
+	excluded          []excludedRow             // rows left out of the last conversion, for RejectsReport
+	linesBeforeHeader int                       // input lines above the header, see inputLine
+	linesSought       int                       // input lines skipped below the header by StartOffset
+	written           outputSummary             // rows of the last conversion, for Manifest
+	fees              map[string]*big.Rat       // fee totals per currency, for FeeReport
+	daily             map[dailyKey]*dailyTotals // per day and asset, for DailySummary
+	amounts           map[string][]*big.Rat     // amounts per asset, for VerboseStats
+	unknownCurrencies []string
+	human             *csv.Writer // HumanOut, while converting
+	stats             Stats
+	unpaired          UnpairedTrades
+	badRows           int                        // rows rejected or unreadable, for MaxErrors
+	seen              map[[sha256.Size]byte]bool // records written, for Dedup
+	warnings          int                        // warnings raised by the last conversion
+}
+
+// finalDepositStatuses are the deposit statuses accepted under
+// StrictDepositStatus, keyed in lower case.
+var finalDepositStatuses = map[string]bool{
+	"complete":  true,
+	"completed": true,
 }
 
 type K33Record struct {
-	TypeStatus      string
-	TradeID         string
-	Side            string
-	Amount          string
-	TradeStatus     string
-	Asset           string
-	Timestamp       string
-	DepositTxhash   string
+	TypeStatus       string
+	TradeID          string
+	OrderID          string
+	Side             string
+	Amount           string
+	TradeStatus      string
+	Asset            string
+	Timestamp        string
+	DepositTxhash    string
 	WithdrawalTxhash string
+	Fee              string
+	FeeCurrency      string
+	GrossAmount      string
+	NetAmount        string
+	UniqueKey        string
+	Direction        string
+	ReferenceID      string
+	Price            string
+	FiatValue        string // fiat value of the row's amount
+	FiatCurrency     string
+
+	raw     []string // original CSV row, for diagnostics
+	columns []string // mapped header of raw's input, see rawRow
+	line    int      // line number in the original input, 0 if unknown
 }
 
+// FeeCurrency choices inferring a trade fee's currency from its legs.
+const (
+	FeeCurrencySell = "sell"
+	FeeCurrencyBuy  = "buy"
+)
+
+// ZeroLegPolicy selects how trades with a zero-amount leg are converted.
+type ZeroLegPolicy string
+
+const (
+	// ZeroLegEmit writes the trade as-is, with a zero on one side.
+	ZeroLegEmit ZeroLegPolicy = "emit"
+	// ZeroLegSkip drops the trade entirely.
+	ZeroLegSkip ZeroLegPolicy = "skip"
+	// ZeroLegTransfer keeps only the non-zero side as a one-sided row.
+	ZeroLegTransfer ZeroLegPolicy = "transfer"
+)
+
+// SignConvention describes how an export signs the amounts of trade legs.
+type SignConvention string
+
+const (
+	// SignOpposite expects a negative sell leg and a positive buy leg.
+	SignOpposite SignConvention = "opposite"
+	// SignNegative expects both legs negative, as amounts leaving their
+	// order books.
+	SignNegative SignConvention = "negative"
+	// SignAny accepts any signs without checking.
+	SignAny SignConvention = "any"
+)
+
+// AmountBasis selects which of a row's gross and net amounts is reported.
+type AmountBasis string
+
+const (
+	// AmountBasisNet reports the net amount, what actually hit the balance.
+	AmountBasisNet AmountBasis = "net"
+	// AmountBasisGross reports the gross amount, before fees.
+	AmountBasisGross AmountBasis = "gross"
+)
+
+// TradeTime selects which leg's timestamp a trade record is dated with.
+type TradeTime string
+
+const (
+	// TradeTimeFirst uses the leg that appeared first in the input.
+	TradeTimeFirst TradeTime = "first"
+	// TradeTimeBuy uses the buy leg, the acquisition.
+	TradeTimeBuy TradeTime = "buy"
+	// TradeTimeSell uses the sell leg.
+	TradeTimeSell TradeTime = "sell"
+	// TradeTimeEarliest and TradeTimeLatest use the earlier or later leg.
+	TradeTimeEarliest TradeTime = "earliest"
+	TradeTimeLatest   TradeTime = "latest"
+)
+
 type TradePair struct {
 	TradeID   string
 	Timestamp string
-	BuyLeg    *K33Record
-	SellLeg   *K33Record
+	BuyLegs   []*K33Record // buy fills, summed into one received amount
+	SellLegs  []*K33Record // sell fills, summed into one sent amount
+	FeeLegs   []*K33Record // separate fee rows sharing the trade's id
+
+	at time.Time // instant of Timestamp, zero if it did not parse
 }
 
 type KoinlyRecord struct {
-	Date             string
-	SentAmount       string
-	SentCurrency     string
-	ReceivedAmount   string
-	ReceivedCurrency string
-	FeeAmount        string
-	FeeCurrency      string
-	NetWorthAmount   string
-	NetWorthCurrency string
-	Label            string
-	Description      string
-	TxHash           string
+	Date             string `json:"date"`
+	SentAmount       string `json:"sent_amount,omitempty"`
+	SentCurrency     string `json:"sent_currency,omitempty"`
+	ReceivedAmount   string `json:"received_amount,omitempty"`
+	ReceivedCurrency string `json:"received_currency,omitempty"`
+	FeeAmount        string `json:"fee_amount,omitempty"`
+	FeeCurrency      string `json:"fee_currency,omitempty"`
+	NetWorthAmount   string `json:"net_worth_amount,omitempty"`
+	NetWorthCurrency string `json:"net_worth_currency,omitempty"`
+	Label            string `json:"label,omitempty"`
+	Description      string `json:"description,omitempty"`
+	TxHash           string `json:"tx_hash,omitempty"`
+	Tag              string `json:"tag,omitempty"`
+
+	kind    string // record type, as returned by recordType
+	ref     string // K33 reference id shared by a withdrawal and its fee line, or an internal transfer's sides
+	feeLine bool   // a withdrawal fee line not yet attached to its withdrawal
+	lines   []int  // input lines the record was converted from
+
+	at time.Time // instant Date was formatted from, zero if unknown
 }
 
+// KoinlyHeader is the exact header line of Koinly Universal CSV. Koinly
+// rejects files whose header differs in any way, including case and
+// spacing.
+const KoinlyHeader = "Date,Sent Amount,Sent Currency,Received Amount,Received Currency," +
+	"Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash"
+
+// koinlyHeader is KoinlyHeader split into columns.
+var koinlyHeader = strings.Split(KoinlyHeader, ",")
+
 func New() *Converter {
 	return &Converter{
-		trades: make(map[string]*TradePair),
+		Format:            FormatCSV,
+		Target:            TargetKoinly,
+		OutputOrder:       OrderInput,
+		ZeroLegPolicy:     ZeroLegEmit,
+		TradeTime:         TradeTimeLatest,
+		AmountBasis:       AmountBasisNet,
+		SignConvention:    SignOpposite,
+		FiatPrecision:     2,
+		CryptoPrecision:   8,
+		FiatValueCurrency: "USD",
+		MaxErrors:         -1,
+		Now:               time.Now,
+		trades:            make(map[string]*TradePair),
 	}
 }
 
-func (c *Converter) parseRecords(in io.Reader) ([]KoinlyRecord, error) {
-	reader := csv.NewReader(in)
+// ErrEmptyInput is returned when the input holds no header row at all,
+// such as a zero-byte file.
+var ErrEmptyInput = errors.New("input file is empty")
 
-	header, err := reader.Read()
+// Convert converts a K33 export and returns its records in output order,
+// without encoding them, for callers that process records themselves.
+// The side reports (FeeReport, VerboseStats, ...) are written as by
+// Process; with Strict, the records are returned along with the
+// *UnpairedTrades error. A Converter can convert several exports in turn:
+// each call starts from fresh pairing state and counts.
+func (c *Converter) Convert(in io.Reader) ([]KoinlyRecord, error) {
+	return c.ConvertAll([]io.Reader{in})
+}
+
+// ConvertAll is Convert over several exports read in order, like
+// ProcessAll.
+func (c *Converter) ConvertAll(ins []io.Reader) ([]KoinlyRecord, error) {
+	records, err := c.parseRecords(ins...)
 	if err != nil {
-		return nil, fmt.Errorf("reading header: %w", err)
+		return nil, err
 	}
+	return records, c.writeReports()
+}
 
-	if err := validateHeader(header); err != nil {
+// parseRecords converts ins, read in order as one export, and returns
+// every record, in output order.
+func (c *Converter) parseRecords(ins ...io.Reader) ([]KoinlyRecord, error) {
+	var records []KoinlyRecord
+	err := c.convert(ins, nil, func(r KoinlyRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
+	return records, nil
+}
 
-	var records []KoinlyRecord
+// convert reads K33 exports in order as one export and passes each
+// converted record to emit as soon as it is complete. begin, when set,
+// runs once the first header has been validated and before any record is
+// emitted. Only trades waiting for a leg are held until end of the last
+// input, so legs split across inputs still pair, and are then resolved or
+// warned about; see recordStream for the other records briefly held back.
+func (c *Converter) convert(ins []io.Reader, begin func() error, emit func(KoinlyRecord) error) error {
+	c.resetRun()
+	var stream *recordStream
+	for i, in := range ins {
+		if len(ins) > 1 {
+			c.infof("Reading input %d of %d", i+1, len(ins))
+		}
+		reader, header, err := c.readHeader(in, i == 0)
+		if err != nil {
+			if len(ins) > 1 {
+				return fmt.Errorf("input %d: %w", i+1, err)
+			}
+			return err
+		}
+		if i > 0 && !slices.Equal(c.mapHeader(c.header), header) {
+			c.warnf("Input %d has a different header than input 1; its columns are matched by name", i+1)
+		}
+
+		if stream == nil {
+			if begin != nil {
+				if err := begin(); err != nil {
+					return err
+				}
+			}
+			c.resetOutput()
+			stream = &recordStream{c: c, emit: emit}
+			defer stream.cleanup()
+			c.stats.count(c.carried)
+			if err := stream.add(c.finalize(c.carried)); err != nil {
+				return err
+			}
+			c.carried = nil
+		}
+		if err := c.convertRows(reader, header, stream); err != nil {
+			return err
+		}
+	}
+	if stream == nil {
+		return ErrEmptyInput
+	}
+
+	resolved := c.resolveUnpaired()
+	if err := c.checkErrorBudget(); err != nil {
+		return err
+	}
+	c.stats.count(resolved)
+	if err := stream.add(c.finalize(resolved)); err != nil {
+		return err
+	}
+	if err := stream.close(); err != nil {
+		return err
+	}
+	if err := c.unknownCurrencyError(); err != nil {
+		return err
+	}
+	if c.unpaired.Count() > 0 && !c.Strict {
+		c.warnf("%v", &c.unpaired)
+	}
+
+	// An empty export is told apart from one whose rows were all dropped
+	switch {
+	case c.stats.Rows == 0:
+		c.warnf("Input has a header but no data rows")
+	case c.written.rows == 0:
+		c.warnf("None of the %d data rows produced output", c.stats.Rows)
+	}
+	if c.skippedDeposits > 0 {
+		c.warnf("Skipped %d deposits with a non-final status", c.skippedDeposits)
+	}
+	if c.droppedFees > 0 {
+		c.infof("Dropped %d fees below the minimum fee", c.droppedFees)
+	}
+	return nil
+}
+
+// resetRun clears the pairing state and row counts a previous conversion
+// left behind, so one Converter can convert several exports in turn.
+// Trades seeded by LoadPending since then are kept for this run.
+func (c *Converter) resetRun() {
+	if !c.seeded {
+		c.resetTrades()
+	}
+	c.seeded = false
+	c.skippedDeposits = 0
+	c.droppedFees = 0
+	c.unrecognized = nil
+	c.uniqueKeys = nil
+	c.warnings = 0
+}
+
+// resetTrades drops every open trade and the records completed while
+// loading pending trades.
+func (c *Converter) resetTrades() {
+	c.trades = make(map[string]*TradePair)
+	c.filled = ""
+	c.carried = nil
+}
+
+// readHeader finds and validates the header of one input, returning a
+// reader positioned at its first record and the header mapped to the
+// canonical column names. StartOffset and c.header apply to the first
+// input only.
+func (c *Converter) readHeader(in io.Reader, first bool) (*csv.Reader, []string, error) {
+	var offset int64
+	if first {
+		offset = c.StartOffset
+	}
+	in, err := c.findHeader(in, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := c.newReader(in)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, ErrEmptyInput
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	if c.AssertColumns != "" {
+		if err := assertSchema(c.AssertColumns, header); err != nil {
+			return nil, nil, err
+		}
+	}
+	if first {
+		c.header = header
+	}
+	if c.linesBeforeHeader > 0 {
+		c.infof("Found the header below %d leading lines", c.linesBeforeHeader)
+	}
+	header = c.mapHeader(header)
+	if err := c.validateHeader(header); err != nil {
+		return nil, nil, err
+	}
+	return reader, header, nil
+}
+
+// convertRows converts the records of one input into stream.
+func (c *Converter) convertRows(reader *csv.Reader, header []string, stream *recordStream) error {
 	for {
 		row, err := reader.Read()
 		if err == io.EOF {
-			break
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && c.MaxErrors >= 0 {
+			c.warnf("Skipping malformed row: %v", err)
+			c.exclude("malformed row", &K33Record{raw: row, columns: header})
+			c.stats.Rows++
+			c.stats.Skipped++
+			c.badRows++
+			if err := c.checkErrorBudget(); err != nil {
+				return err
+			}
+			continue
 		}
 		if err != nil {
-			return nil, fmt.Errorf("reading record: %w", err)
+			return fmt.Errorf("reading record: %w", err)
 		}
+		c.stats.Rows++
 
-		k33 := parseK33Record(header, row)
-		if k33.TradeStatus == "Reject" {
+		if !c.NoTrim {
+			row = trimCells(row)
+		}
+		k33 := c.parseK33Record(header, row)
+		line, _ := reader.FieldPos(0)
+		k33.line = c.inputLine(line)
+		if c.isRejectStatus(k33) {
+			c.exclude("rejected status", &k33)
+			c.stats.Rejected++
 			continue
 		}
-		records = append(records, c.processK33Record(k33)...)
-	}
-
-	for _, trade := range c.trades {
-		if trade.BuyLeg != nil || trade.SellLeg != nil {
-			log.Printf("Warning: Unpaired trade %s", trade.TradeID)
+		converted := c.settleFilled(&k33)
+		rowRecords := c.processK33Record(k33)
+		if at, err := parseTimestamp(k33.Timestamp); err == nil {
+			for i := range rowRecords {
+				// Trades carry the instant tradeTimestamp chose
+				if rowRecords[i].kind != "trade" {
+					rowRecords[i].at = at
+				}
+			}
+		}
+		converted = append(converted, rowRecords...)
+		c.stats.count(converted)
+		for i := range converted {
+			if converted[i].lines == nil {
+				converted[i].lines = []int{k33.line}
+			}
+		}
+		if err := stream.add(c.finalize(converted)); err != nil {
+			return err
+		}
+		if err := c.checkErrorBudget(); err != nil {
+			return err
 		}
 	}
-
-	return records, nil
 }
 
+// flushEvery is how many rows Process writes between flushes.
+const flushEvery = 1000
+
+// Process converts in and writes it to out, streaming rows as they are
+// converted.
 func (c *Converter) Process(in io.Reader, out io.Writer) error {
-	records, err := c.parseRecords(in)
-	if err != nil {
-		return err
+	return c.ProcessAll([]io.Reader{in}, out)
+}
+
+// ProcessAll converts several exports, such as monthly files, in order
+// into one output, as if they were a single export: the output header is
+// written once and trades pair across inputs.
+func (c *Converter) ProcessAll(ins []io.Reader, out io.Writer) error {
+	if c.Format == FormatJSONL {
+		return c.processJSONL(ins, out)
 	}
 
-	writer := csv.NewWriter(out)
+	writer := c.newWriter(out)
 	defer writer.Flush()
 
-	koinlyHeader := []string{
-		"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
-		"Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency",
-		"Label", "Description", "TxHash",
-	}
-	if err := writer.Write(koinlyHeader); err != nil {
-		return fmt.Errorf("writing header: %w", err)
+	var tee *json.Encoder
+	if c.TeeJSON != nil {
+		tee = json.NewEncoder(c.TeeJSON)
 	}
 
-	for _, record := range records {
-		row := []string{
-			record.Date, record.SentAmount, record.SentCurrency,
-			record.ReceivedAmount, record.ReceivedCurrency,
-			record.FeeAmount, record.FeeCurrency,
-			record.NetWorthAmount, record.NetWorthCurrency,
-			record.Label, record.Description, record.TxHash,
+	begin := func() error {
+		if c.BOM {
+			if _, err := io.WriteString(out, "\ufeff"); err != nil {
+				return fmt.Errorf("writing BOM: %w", err)
+			}
 		}
-		if err := writer.Write(row); err != nil {
+		if err := writer.Write(c.outputHeader()); err != nil {
+			return fmt.Errorf("writing header: %w", err)
+		}
+		return nil
+	}
+	seq := 0
+	emit := func(record KoinlyRecord) error {
+		seq++
+		if err := writer.Write(c.outputRow(seq, record)); err != nil {
 			return fmt.Errorf("writing record: %w", err)
 		}
+		if tee != nil {
+			if err := tee.Encode(record); err != nil {
+				return fmt.Errorf("writing tee record: %w", err)
+			}
+		}
+		if seq%flushEvery == 0 {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return fmt.Errorf("writing record: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := c.convert(ins, begin, emit); err != nil {
+		return err
 	}
 
-	return nil
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return c.writeReports()
+}
+
+// outputRow renders record, the seq'th row written, as a row of the
+// configured target. Zero filling only touches the written cells, so the
+// record itself keeps empty and zero distinct.
+func (c *Converter) outputRow(seq int, record KoinlyRecord) []string {
+	if c.ZeroFillAmounts {
+		for _, amount := range []*string{&record.SentAmount, &record.ReceivedAmount, &record.FeeAmount} {
+			if *amount == "" {
+				*amount = "0"
+			}
+		}
+	}
+
+	row := koinlyRow(record)
+	if c.Target == TargetCoinTracking {
+		row = cointrackingRow(record)
+	}
+	if c.tagging() {
+		row = append(row, record.Tag)
+	}
+	if c.WithSeq {
+		row = append([]string{strconv.Itoa(seq)}, row...)
+	}
+	if len(c.Transforms) > 0 {
+		for i, col := range c.outputHeader() {
+			if transform := c.Transforms[col]; transform != nil {
+				row[i] = transform(row[i])
+			}
+		}
+	}
+	return row
+}
+
+// koinlyRow renders record in koinlyHeader column order.
+func koinlyRow(record KoinlyRecord) []string {
+	return []string{
+		record.Date, record.SentAmount, record.SentCurrency,
+		record.ReceivedAmount, record.ReceivedCurrency,
+		record.FeeAmount, record.FeeCurrency,
+		record.NetWorthAmount, record.NetWorthCurrency,
+		record.Label, record.Description, record.TxHash,
+	}
 }
 
 func (c *Converter) ProcessDryRun(in io.Reader, out io.Writer) error {
-	records, err := c.parseRecords(in)
+	return c.ProcessDryRunAll([]io.Reader{in}, out)
+}
+
+// ProcessDryRunAll is ProcessDryRun over several exports read in order,
+// like ProcessAll.
+func (c *Converter) ProcessDryRunAll(ins []io.Reader, out io.Writer) error {
+	records, err := c.parseRecords(ins...)
 	if err != nil {
 		return err
 	}
@@ -136,21 +831,30 @@ func (c *Converter) ProcessDryRun(in io.Reader, out io.Writer) error {
 	fmt.Fprintln(out, "==================================")
 
 	for _, r := range records {
-		fmt.Fprintf(out, "%s | %s %s -> %s %s | %s\n",
+		line := fmt.Sprintf("%s | %s %s -> %s %s | %s",
 			r.Date,
 			r.SentAmount, r.SentCurrency,
 			r.ReceivedAmount, r.ReceivedCurrency,
 			r.Description)
+		if c.Color {
+			line = colorize(r, line)
+		}
+		fmt.Fprintln(out, line)
 	}
 
-	return nil
+	return c.writeReports()
 }
 
-func validateHeader(header []string) error {
+// validateHeader checks header has the columns every export needs. With
+// InferTypeFromSign the Type/Status column may be left out.
+func (c *Converter) validateHeader(header []string) error {
 	required := []string{"Type/Status", "Timestamp (UTC)"}
+	if c.InferTypeFromSign {
+		required = required[1:]
+	}
 	clean := make(map[string]bool, len(header))
 	for _, col := range header {
-		clean[strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))] = true
+		clean[cleanColumn(col)] = true
 	}
 	for _, req := range required {
 		if !clean[req] {
@@ -160,22 +864,25 @@ func validateHeader(header []string) error {
 	return nil
 }
 
-func parseK33Record(header []string, record []string) K33Record {
-	k33 := K33Record{}
-	
+func (c *Converter) parseK33Record(header []string, record []string) K33Record {
+	k33 := K33Record{raw: record, columns: header}
+	var change string
+
 	for i, col := range header {
 		if i >= len(record) {
 			continue
 		}
-		
+
 		// Clean BOM and whitespace from column names
-		col = strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))
-		
+		col = cleanColumn(col)
+
 		switch col {
 		case "Type/Status":
 			k33.TypeStatus = record[i]
 		case "TradeID":
 			k33.TradeID = formatTradeID(record[i])
+		case "OrderID":
+			k33.OrderID = formatTradeID(record[i])
 		case "Side":
 			k33.Side = record[i]
 		case "Amount":
@@ -190,9 +897,63 @@ func parseK33Record(header []string, record []string) K33Record {
 			k33.DepositTxhash = record[i]
 		case "WithdrawalTxhash":
 			k33.WithdrawalTxhash = record[i]
+		case "Fee":
+			k33.Fee = record[i]
+		case "Fee Currency":
+			k33.FeeCurrency = record[i]
+		case "Direction":
+			k33.Direction = record[i]
+		case "UniqueKey":
+			k33.UniqueKey = record[i]
+		case "Gross Amount":
+			k33.GrossAmount = record[i]
+		case "Net Amount":
+			k33.NetAmount = record[i]
+		case "InternalReportID":
+			k33.ReferenceID = record[i]
+		case "Price":
+			k33.Price = record[i]
+		case "Fiat Value":
+			k33.FiatValue = record[i]
+		case "Fiat Currency":
+			k33.FiatCurrency = record[i]
+		case "Change":
+			change = record[i]
 		}
 	}
-	
+	// Minimal exports give a signed Change instead of an Amount
+	if k33.Amount == "" {
+		k33.Amount = change
+	}
+
+	k33.Amount = c.stripAnnotation(k33.Amount)
+	k33.Fee = c.stripAnnotation(k33.Fee)
+
+	if amount, currency, ok := stripCurrencySymbol(k33.Amount); ok {
+		k33.Amount = amount
+		if k33.Asset == "" {
+			k33.Asset = currency
+		}
+	}
+	if fee, currency, ok := stripCurrencySymbol(k33.Fee); ok {
+		k33.Fee = fee
+		if k33.FeeCurrency == "" {
+			k33.FeeCurrency = currency
+		}
+	}
+	if value, currency, ok := stripCurrencySymbol(k33.FiatValue); ok {
+		k33.FiatValue = value
+		if k33.FiatCurrency == "" {
+			k33.FiatCurrency = currency
+		}
+	}
+
+	for _, amount := range []*string{&k33.Amount, &k33.Fee, &k33.GrossAmount, &k33.NetAmount, &k33.FiatValue} {
+		if *amount != "" {
+			*amount = normalizeAmount(*amount)
+		}
+	}
+
 	return k33
 }
 
@@ -206,113 +967,895 @@ func formatTradeID(tradeID string) string {
 		return tradeID
 	}
 
-	// Use big.Float to avoid float64 precision loss on large integers
-	f, _, err := big.ParseFloat(tradeID, 10, 128, big.ToNearestEven)
+	// Convert exactly rather than rounding to an integer, so distinct ids
+	// such as 1.0000000123451e+12 and 1.0000000123454e+12 never collide
+	r, err := parseAmount(tradeID)
 	if err != nil {
 		return tradeID
 	}
-	return f.Text('f', 0)
+	return formatAmount(r)
 }
 
 func (c *Converter) processK33Record(k33 K33Record) []KoinlyRecord {
+	if c.InferTypeFromSign && k33.TypeStatus == "" {
+		k33.TypeStatus = typeFromSign(k33.Amount)
+	}
+
 	// Skip records with empty required fields
 	if k33.TypeStatus == "" || k33.Timestamp == "" {
+		reason := "empty timestamp"
+		if k33.TypeStatus == "" {
+			reason = "empty Type/Status"
+		}
+		c.warnf("Skipping row at line %d: %s", k33.line, reason)
+		c.exclude(reason, &k33)
+		c.stats.Skipped++
+		return nil
+	}
+
+	if err := c.normalizeRow(&k33); err != nil {
+		c.warnf("Skipping %s row at %s: %v", k33.TypeStatus, k33.Timestamp, err)
+		c.exclude(err.Error(), &k33)
+		c.stats.Skipped++
+		c.badRows++
+		return nil
+	}
+
+	c.checkUniqueKey(k33)
+	timestamp := c.convertTimestamp(k33.Timestamp)
+
+	// Trades are filtered once both legs are known
+	if k33.TypeStatus != "Trade" && !isTradeFee(k33) && !c.inWindow(k33.Timestamp) {
+		c.exclude("outside time window", &k33)
+		c.stats.Skipped++
 		return nil
 	}
-	
-	timestamp := convertTimestamp(k33.Timestamp)
-	
+
 	switch {
+	// Checked before Deposit: forks may be exported as "Fork Deposit ..."
+	case isForkType(k33.TypeStatus):
+		return []KoinlyRecord{c.createForkRecord(k33, timestamp)}
+
+	// Checked before Deposit/Withdrawal: locks are not income or disposals
+	case isStakingLock(k33.TypeStatus):
+		return []KoinlyRecord{c.createStakingLockRecord(k33, timestamp)}
+
+	// Checked before Deposit: payouts may be exported as "Reward Deposit"
+	case isRewardType(k33.TypeStatus):
+		return []KoinlyRecord{c.createRewardRecord(k33, timestamp)}
+
+	// Checked before Deposit: payouts may be exported as "Interest Deposit"
+	case isInterestType(k33.TypeStatus):
+		return []KoinlyRecord{c.createInterestRecord(k33, timestamp)}
+
+	case isAdjustment(k33.TypeStatus):
+		return []KoinlyRecord{c.createAdjustmentRecord(k33, timestamp)}
+
 	case strings.Contains(k33.TypeStatus, "Deposit"):
+		if c.SkipDeposits {
+			c.exclude("deposits skipped", &k33)
+			c.stats.Skipped++
+			return nil
+		}
+		if c.StrictDepositStatus && !isFinalDepositStatus(k33.TypeStatus) {
+			c.exclude("non-final deposit status", &k33)
+			c.skippedDeposits++
+			c.stats.Skipped++
+			return nil
+		}
 		return []KoinlyRecord{c.createDepositRecord(k33, timestamp)}
-		
+
+	case isWithdrawalFee(k33.TypeStatus):
+		if c.SkipWithdrawals {
+			c.exclude("withdrawals skipped", &k33)
+			c.stats.Skipped++
+			return nil
+		}
+		return []KoinlyRecord{c.createWithdrawalFeeRecord(k33, timestamp)}
+
 	case strings.Contains(k33.TypeStatus, "Withdrawal"):
+		if c.SkipWithdrawals {
+			c.exclude("withdrawals skipped", &k33)
+			c.stats.Skipped++
+			return nil
+		}
 		return []KoinlyRecord{c.createWithdrawalRecord(k33, timestamp)}
-		
-	case k33.TypeStatus == "Trade":
+
+	case k33.TypeStatus == "Trade" || isTradeFee(k33):
+		if c.SkipTrades {
+			c.exclude("trades skipped", &k33)
+			c.stats.Skipped++
+			return nil
+		}
 		return c.processTrade(k33, timestamp)
+
+	case k33.Direction != "" && c.direction(k33) == "in":
+		return []KoinlyRecord{c.createDepositRecord(k33, timestamp)}
+
+	case k33.Direction != "" && c.direction(k33) == "out":
+		return []KoinlyRecord{c.createWithdrawalRecord(k33, timestamp)}
+	}
+
+	c.recordUnrecognized(k33)
+	return nil
+}
+
+// normalizeRow validates the amounts of k33, scales them by UnitDivisors
+// and sets the Side of Direction-layout trade legs. Pending legs are saved
+// as raw rows, so LoadPending normalizes them again when they are
+// reloaded.
+func (c *Converter) normalizeRow(k33 *K33Record) error {
+	if err := validateAmounts(*k33); err != nil {
+		return err
+	}
+	c.applyUnitDivisors(k33)
+
+	// Direction layouts give trade legs an in/out instead of a Side
+	if k33.TypeStatus == "Trade" && k33.Side == "" {
+		switch c.direction(*k33) {
+		case "in":
+			k33.Side = "Buy"
+		case "out":
+			k33.Side = "Sell"
+		}
 	}
-	
 	return nil
 }
 
+// recordType classifies a K33 row for per-type bookkeeping.
+func recordType(k33 K33Record) string {
+	switch {
+	case isForkType(k33.TypeStatus):
+		return "fork"
+	case isStakingLock(k33.TypeStatus):
+		return "staking"
+	case isRewardType(k33.TypeStatus):
+		return "reward"
+	case isInterestType(k33.TypeStatus):
+		return "interest"
+	case isAdjustment(k33.TypeStatus):
+		return "adjustment"
+	case strings.Contains(k33.TypeStatus, "Deposit"):
+		return "deposit"
+	case strings.Contains(k33.TypeStatus, "Withdrawal"):
+		return "withdrawal"
+	case k33.TypeStatus == "Trade" || isTradeFee(k33):
+		return "trade"
+	}
+	return "unknown"
+}
+
+// checkUniqueKey warns when a UniqueKey is reused by a different record
+// type, which K33 exports occasionally do. Keys are only meaningful within
+// a record type (both legs of a trade share one).
+func (c *Converter) checkUniqueKey(k33 K33Record) {
+	if k33.UniqueKey == "" {
+		return
+	}
+	if c.uniqueKeys == nil {
+		c.uniqueKeys = make(map[string][]string)
+	}
+	kind := recordType(k33)
+	kinds := c.uniqueKeys[k33.UniqueKey]
+	if slices.Contains(kinds, kind) {
+		return
+	}
+	if len(kinds) > 0 {
+		c.warnf("UniqueKey %s used by both %s and %s rows", k33.UniqueKey, strings.Join(kinds, "/"), kind)
+	}
+	c.uniqueKeys[k33.UniqueKey] = append(kinds, kind)
+}
+
+// isFinalDepositStatus reports whether the status following "Deposit" in
+// typeStatus (e.g. "Deposit Complete") is a known final state.
+func isFinalDepositStatus(typeStatus string) bool {
+	_, status, _ := strings.Cut(typeStatus, "Deposit")
+	return finalDepositStatuses[strings.ToLower(strings.TrimSpace(status))]
+}
+
 func (c *Converter) createDepositRecord(k33 K33Record, timestamp string) KoinlyRecord {
 	amount := strings.TrimPrefix(k33.Amount, "-")
-	
+
+	record := KoinlyRecord{
+		Date:             timestamp,
+		ReceivedAmount:   amount,
+		ReceivedCurrency: k33.Asset,
+		Description:      c.describe("deposit", c.assetClass(k33.Asset)+" Deposit (K33)", rowVars(k33)),
+		kind:             "deposit",
+		TxHash:           k33.DepositTxhash,
+		ref:              k33.ReferenceID,
+	}
+
+	// A deposit that nets out a fee is credited the net amount (or gross,
+	// per AmountBasis), with the difference recorded as the fee
+	if gross, net, fee, ok := c.splitGrossNet(k33); ok {
+		record.ReceivedAmount = net
+		if c.AmountBasis == AmountBasisGross {
+			record.ReceivedAmount = gross
+		}
+		if fee != "" {
+			record.FeeAmount = fee
+			record.FeeCurrency = k33.Asset
+		}
+	}
+
+	return record
+}
+
+// splitGrossNet returns the absolute gross and net amounts of a row
+// carrying both, and the fee between them (empty when they are equal).
+// ok is false unless both columns hold valid amounts.
+func (c *Converter) splitGrossNet(k33 K33Record) (gross, net, fee string, ok bool) {
+	if k33.GrossAmount == "" || k33.NetAmount == "" {
+		return "", "", "", false
+	}
+	g, err := parseAmount(k33.GrossAmount)
+	if err != nil {
+		return "", "", "", false
+	}
+	n, err := parseAmount(k33.NetAmount)
+	if err != nil {
+		return "", "", "", false
+	}
+
+	g.Abs(g)
+	n.Abs(n)
+	diff := new(big.Rat).Sub(g, n)
+	if diff.Sign() < 0 {
+		c.warnf("Net amount %s exceeds gross amount %s", k33.NetAmount, k33.GrossAmount)
+		return formatAmount(g), formatAmount(n), "", true
+	}
+	if diff.Sign() > 0 {
+		fee = formatAmount(diff)
+	}
+	return formatAmount(g), formatAmount(n), fee, true
+}
+
+// isForkType reports whether typeStatus is a chain fork or split credit.
+func isForkType(typeStatus string) bool {
+	return strings.Contains(typeStatus, "Fork") || strings.Contains(typeStatus, "Split")
+}
+
+func (c *Converter) createForkRecord(k33 K33Record, timestamp string) KoinlyRecord {
+	amount := strings.TrimPrefix(k33.Amount, "-")
+
 	return KoinlyRecord{
 		Date:             timestamp,
 		ReceivedAmount:   amount,
 		ReceivedCurrency: k33.Asset,
-		Description:      "Deposit (K33)",
-		TxHash:          k33.DepositTxhash,
+		Label:            "fork",
+		Description:      c.describe("fork", "Fork (K33)", rowVars(k33)),
+		kind:             "fork",
+		TxHash:           k33.DepositTxhash,
 	}
 }
 
-func (c *Converter) createWithdrawalRecord(k33 K33Record, timestamp string) KoinlyRecord {
+// isStakingLock reports whether typeStatus moves funds into or out of
+// staking ("Staking Deposit"/"Staking Withdrawal"), as opposed to a
+// "Staking Reward" payout.
+func isStakingLock(typeStatus string) bool {
+	return strings.Contains(typeStatus, "Staking Deposit") || strings.Contains(typeStatus, "Staking Withdrawal")
+}
+
+// createStakingLockRecord maps a staking lock or unlock to an unlabeled
+// transfer, so Koinly neither taxes it as income nor as a disposal.
+func (c *Converter) createStakingLockRecord(k33 K33Record, timestamp string) KoinlyRecord {
+	amount := strings.TrimPrefix(k33.Amount, "-")
+
+	if strings.Contains(k33.TypeStatus, "Staking Withdrawal") {
+		return KoinlyRecord{
+			Date:             timestamp,
+			ReceivedAmount:   amount,
+			ReceivedCurrency: k33.Asset,
+			Description:      c.describe("staking", "Staking unlock (K33)", rowVars(k33)),
+			kind:             "staking",
+		}
+	}
+	return KoinlyRecord{
+		Date:         timestamp,
+		SentAmount:   amount,
+		SentCurrency: k33.Asset,
+		Description:  c.describe("staking", "Staking lock (K33)", rowVars(k33)),
+		kind:         "staking",
+	}
+}
+
+// isRewardType reports whether typeStatus is a staking or earn payout.
+// Staking locks also contain "Staking" and must be matched first.
+func isRewardType(typeStatus string) bool {
+	return strings.Contains(typeStatus, "Reward") || strings.Contains(typeStatus, "Staking")
+}
+
+// createRewardRecord maps a payout to a received row labeled "reward", so
+// Koinly books it as income.
+func (c *Converter) createRewardRecord(k33 K33Record, timestamp string) KoinlyRecord {
 	amount := strings.TrimPrefix(k33.Amount, "-")
-	
+
+	return KoinlyRecord{
+		Date:             timestamp,
+		ReceivedAmount:   amount,
+		ReceivedCurrency: k33.Asset,
+		Label:            "reward",
+		Description:      c.describe("reward", "Reward (K33)", rowVars(k33)),
+		kind:             "reward",
+		TxHash:           k33.DepositTxhash,
+	}
+}
+
+// isInterestType reports whether typeStatus is an interest or lending
+// payout, e.g. interest accrued on a fiat balance.
+func isInterestType(typeStatus string) bool {
+	return strings.Contains(typeStatus, "Interest")
+}
+
+// createInterestRecord maps an interest payout to a received row labeled
+// "interest", so Koinly books it as income.
+func (c *Converter) createInterestRecord(k33 K33Record, timestamp string) KoinlyRecord {
+	amount := strings.TrimPrefix(k33.Amount, "-")
+
 	return KoinlyRecord{
+		Date:             timestamp,
+		ReceivedAmount:   amount,
+		ReceivedCurrency: k33.Asset,
+		Label:            "interest",
+		Description:      c.describe("interest", "Interest (K33)", rowVars(k33)),
+		kind:             "interest",
+		TxHash:           k33.DepositTxhash,
+	}
+}
+
+// isAdjustment reports whether typeStatus is a balance correction posted
+// by K33.
+func isAdjustment(typeStatus string) bool {
+	return strings.Contains(typeStatus, "Adjustment")
+}
+
+// createAdjustmentRecord maps a balance correction to a row labeled
+// "adjustment": received when the amount is positive, sent when negative.
+func (c *Converter) createAdjustmentRecord(k33 K33Record, timestamp string) KoinlyRecord {
+	record := KoinlyRecord{
+		Date:        timestamp,
+		Label:       "adjustment",
+		Description: c.describe("adjustment", "Adjustment (K33)", rowVars(k33)),
+		kind:        "adjustment",
+	}
+	if amount, found := strings.CutPrefix(k33.Amount, "-"); found {
+		record.SentAmount, record.SentCurrency = amount, k33.Asset
+	} else {
+		record.ReceivedAmount, record.ReceivedCurrency = k33.Amount, k33.Asset
+	}
+	return record
+}
+
+func (c *Converter) createWithdrawalRecord(k33 K33Record, timestamp string) KoinlyRecord {
+	amount := strings.TrimPrefix(k33.Amount, "-")
+
+	record := KoinlyRecord{
 		Date:         timestamp,
 		SentAmount:   amount,
 		SentCurrency: k33.Asset,
-		Description:  "Withdrawal (K33)",
-		TxHash:      k33.WithdrawalTxhash,
+		Description:  c.describe("withdrawal", c.assetClass(k33.Asset)+" Withdrawal (K33)", rowVars(k33)),
+		kind:         "withdrawal",
+		TxHash:       k33.WithdrawalTxhash,
+		ref:          k33.ReferenceID,
 	}
+
+	// As for deposits, the amount sent is the net (or gross) amount and
+	// the difference is the fee
+	if gross, net, fee, ok := c.splitGrossNet(k33); ok {
+		record.SentAmount = net
+		if c.AmountBasis == AmountBasisGross {
+			record.SentAmount = gross
+		}
+		if fee != "" {
+			record.FeeAmount = fee
+			record.FeeCurrency = k33.Asset
+		}
+	}
+
+	return record
+}
+
+// checkLegSign warns about a trade leg whose amount is signed against
+// c.SignConvention. Direction layouts carry unsigned amounts and are not
+// checked.
+func (c *Converter) checkLegSign(k33 K33Record) {
+	if c.SignConvention == SignAny || k33.Direction != "" || k33.Amount == "" {
+		return
+	}
+	amount, err := parseAmount(k33.Amount)
+	if err != nil || amount.Sign() == 0 {
+		return
+	}
+
+	want := -1
+	if k33.Side == "Buy" && c.SignConvention == SignOpposite {
+		want = 1
+	}
+	if amount.Sign() != want {
+		c.warnf("Trade %s %s leg amount %s does not match the %s sign convention", k33.TradeID, k33.Side, k33.Amount, c.SignConvention)
+	}
+}
+
+// pairKey is the id a trade leg is paired on: its OrderID when the export
+// has one, since some exports give each leg its own TradeID, else TradeID.
+func pairKey(k33 K33Record) string {
+	if k33.OrderID != "" {
+		return k33.OrderID
+	}
+	return k33.TradeID
 }
 
 func (c *Converter) processTrade(k33 K33Record, timestamp string) []KoinlyRecord {
-	if k33.TradeID == "" {
+	key := pairKey(k33)
+	if key == "" {
+		c.reject("trade row has no TradeID or OrderID", &k33)
 		return nil
 	}
-	
-	trade, exists := c.trades[k33.TradeID]
+
+	// Fee rows need no side, and pair-asset rows may take it from the
+	// amount's sign; any other leg must say which side it is
+	if !isTradeFee(k33) {
+		switch strings.ToLower(k33.Side) {
+		case "buy":
+			k33.Side = "Buy"
+		case "sell":
+			k33.Side = "Sell"
+		default:
+			if k33.Side != "" || !isPairAsset(k33.Asset) {
+				c.reject(fmt.Sprintf("trade %s row has Side %q, want Buy or Sell", key, k33.Side), &k33)
+				return nil
+			}
+		}
+	}
+
+	trade, exists := c.trades[key]
 	if !exists {
+		at, _ := parseTimestamp(k33.Timestamp)
 		trade = &TradePair{
-			TradeID:   k33.TradeID,
+			TradeID:   key,
 			Timestamp: timestamp,
+			at:        at,
+		}
+		c.trades[key] = trade
+	}
+
+	if isTradeFee(k33) {
+		trade.FeeLegs = append(trade.FeeLegs, &k33)
+		return nil
+	}
+
+	if isPairAsset(k33.Asset) {
+		buy, sell, err := splitPairTrade(k33)
+		if err != nil {
+			c.reject(err.Error(), &k33)
+			delete(c.trades, key)
+			return nil
 		}
-		c.trades[k33.TradeID] = trade
+		trade.BuyLegs, trade.SellLegs = []*K33Record{buy}, []*K33Record{sell}
+		delete(c.trades, key)
+		return c.completeTrade(trade)
 	}
-	
-	// Store the trade leg
+
+	c.checkLegSign(k33)
+
+	// Store the trade leg; partial fills add to their side
 	if k33.Side == "Buy" {
-		trade.BuyLeg = &k33
+		trade.BuyLegs = c.addFill(trade, trade.BuyLegs, &k33)
 	} else if k33.Side == "Sell" {
-		trade.SellLeg = &k33
+		trade.SellLegs = c.addFill(trade, trade.SellLegs, &k33)
 	}
-	
-	// If we have both legs, create the Koinly record
-	if trade.BuyLeg != nil && trade.SellLeg != nil {
-		record := c.createTradeRecord(trade)
-		delete(c.trades, k33.TradeID) // Remove completed trade
-		return []KoinlyRecord{record}
+
+	// With both sides present the trade completes once its rows end, as
+	// more fills may follow; see settleFilled
+	if len(trade.BuyLegs) > 0 && len(trade.SellLegs) > 0 {
+		c.filled = key
 	}
-	
+
 	return nil
 }
 
-func (c *Converter) createTradeRecord(trade *TradePair) KoinlyRecord {
-	buyAmount := strings.TrimPrefix(trade.BuyLeg.Amount, "-")
-	sellAmount := strings.TrimPrefix(trade.SellLeg.Amount, "-")
-	
+// addFill appends a partial fill to one side of trade. A fill in a
+// different asset than the side's earlier fills is a data error: it is
+// rejected rather than summed.
+func (c *Converter) addFill(trade *TradePair, legs []*K33Record, fill *K33Record) []*K33Record {
+	if len(legs) > 0 && legs[0].Asset != fill.Asset {
+		c.reject(fmt.Sprintf("trade %s has %s fills in both %s and %s", trade.TradeID, fill.Side, legs[0].Asset, fill.Asset), fill)
+		return legs
+	}
+	return append(legs, fill)
+}
+
+// settleFilled completes the trade waiting for further fills unless next
+// is another of its rows. A nil next (end of input) always completes it.
+func (c *Converter) settleFilled(next *K33Record) []KoinlyRecord {
+	if c.filled == "" {
+		return nil
+	}
+	if next != nil && recordType(*next) == "trade" && pairKey(*next) == c.filled {
+		return nil
+	}
+	trade := c.trades[c.filled]
+	delete(c.trades, c.filled)
+	c.filled = ""
+	return c.completeTrade(trade)
+}
+
+// fillTotal sums the absolute amounts of one side's fills. A single fill
+// keeps its amount as exported.
+func fillTotal(legs []*K33Record) string {
+	if len(legs) == 1 {
+		return strings.TrimPrefix(legs[0].Amount, "-")
+	}
+	total := new(big.Rat)
+	for _, leg := range legs {
+		if amount, err := parseAmount(leg.Amount); err == nil {
+			total.Add(total, amount.Abs(amount))
+		}
+	}
+	return formatAmount(total)
+}
+
+// resolveUnpaired handles trades still missing a leg at end of input.
+// A lone leg is completed from c.Prices when possible; everything else is
+// reported as unpaired. With MergeWindow set, nearby orphan legs are
+// merged first.
+func (c *Converter) resolveUnpaired() []KoinlyRecord {
+	ids := make([]string, 0, len(c.trades))
+	for id := range c.trades {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	c.unpaired = UnpairedTrades{}
+	records := c.settleFilled(nil)
+	if c.MergeWindow > 0 {
+		records = append(records, c.mergeOrphans()...)
+	}
+	for _, id := range ids {
+		trade, ok := c.trades[id]
+		if !ok {
+			continue // merged above
+		}
+		if c.Prices != nil && c.reconstructQuoteLeg(trade) {
+			delete(c.trades, id)
+			records = append(records, c.completeTrade(trade)...)
+			continue
+		}
+		if len(trade.BuyLegs) > 0 {
+			c.warnDuplicateSide(trade.TradeID, "Buy", "Sell", trade.BuyLegs)
+			c.exclude("unpaired trade", trade.BuyLegs...)
+			c.unpaired.BuyOnly = append(c.unpaired.BuyOnly, trade.TradeID)
+			continue
+		}
+		if len(trade.SellLegs) > 0 {
+			c.warnDuplicateSide(trade.TradeID, "Sell", "Buy", trade.SellLegs)
+			c.exclude("unpaired trade", trade.SellLegs...)
+			c.unpaired.SellOnly = append(c.unpaired.SellOnly, trade.TradeID)
+			continue
+		}
+		if len(trade.FeeLegs) > 0 {
+			// Fee rows whose trade completed before they were read
+			c.warnf("Fee rows for trade %s have no open trade; writing them as cost rows", trade.TradeID)
+			delete(c.trades, id)
+			fees := feeRecords(trade, trade.Timestamp, trade.at, c.tradeFees(trade))
+			for i := range fees {
+				fees[i].lines = tradeLines(trade)
+			}
+			records = append(records, fees...)
+		}
+	}
+	return records
+}
+
+// warnDuplicateSide warns about an unpaired trade with several rows on its
+// only side. Partial fills are normal once the other side arrives, but with
+// it missing the likelier cause is a row exported with the wrong Side.
+func (c *Converter) warnDuplicateSide(tradeID, side, missing string, legs []*K33Record) {
+	if len(legs) < 2 {
+		return
+	}
+	lines := make([]string, len(legs))
+	for i, leg := range legs {
+		lines[i] = strconv.Itoa(leg.line)
+	}
+	c.warnf("Trade %s has %d %s rows (lines %s) and no %s row; one may have the wrong Side", tradeID, len(legs), side, strings.Join(lines, ", "), missing)
+}
+
+// completeTrade converts a trade whose legs are both known.
+func (c *Converter) completeTrade(trade *TradePair) []KoinlyRecord {
+	if !c.tradeInWindow(trade) {
+		c.exclude("outside time window", slices.Concat(trade.SellLegs, trade.BuyLegs, trade.FeeLegs)...)
+		c.stats.Skipped++
+		return nil
+	}
+	fees := c.tradeFees(trade)
+	record := c.createTradeRecord(trade, fees)
+	if problem := tradeProblem(record); problem != "" {
+		c.reject(problem, append(slices.Clone(trade.SellLegs), trade.BuyLegs...)...)
+		return nil
+	}
+	c.checkTradePrice(trade, record)
+	records := c.applyZeroLegPolicy(record)
+	if len(records) > 0 && len(fees) > 1 {
+		// Koinly rows hold one fee; fees in further currencies get their own
+		records = append(records, feeRecords(trade, record.Date, record.at, fees[1:])...)
+	}
+	lines := tradeLines(trade)
+	for i := range records {
+		records[i].lines = lines
+	}
+	return records
+}
+
+// createTradeRecord converts a paired trade, carrying the first of fees.
+func (c *Converter) createTradeRecord(trade *TradePair, fees []tradeFee) KoinlyRecord {
+	buyAmount := fillTotal(trade.BuyLegs)
+	sellAmount := fillTotal(trade.SellLegs)
+	var feeAmount, feeCurrency string
+	if len(fees) > 0 {
+		feeAmount, feeCurrency = formatAmount(fees[0].amount), fees[0].currency
+	}
+
+	date, at := c.tradeTimestamp(trade)
+	netWorth, netWorthCurrency := c.tradeNetWorth(trade)
+	sentCurrency, receivedCurrency := trade.SellLegs[0].Asset, trade.BuyLegs[0].Asset
+	if c.fiatSidesSwapped(trade) {
+		c.warnf("Trade %s %s leg is signed as sent; swapping its Buy/Sell sides", trade.TradeID, receivedCurrency)
+		sellAmount, buyAmount = buyAmount, sellAmount
+		sentCurrency, receivedCurrency = receivedCurrency, sentCurrency
+	}
+
 	return KoinlyRecord{
-		Date:             trade.Timestamp,
+		Date:             date,
 		SentAmount:       sellAmount,
-		SentCurrency:     trade.SellLeg.Asset,
+		SentCurrency:     sentCurrency,
 		ReceivedAmount:   buyAmount,
-		ReceivedCurrency: trade.BuyLeg.Asset,
-		Description:      fmt.Sprintf("Trade (K33) - %s", trade.TradeID),
+		ReceivedCurrency: receivedCurrency,
+		FeeAmount:        feeAmount,
+		FeeCurrency:      feeCurrency,
+		NetWorthAmount:   netWorth,
+		NetWorthCurrency: netWorthCurrency,
+		Description:      c.describe("trade", fmt.Sprintf("Trade (K33) - %s", trade.TradeID), c.tradeVars(trade.TradeID, sentCurrency, receivedCurrency)),
+		TxHash:           c.tradeTxHash(trade),
+		kind:             "trade",
+		at:               at,
+	}
+}
+
+// fiatSidesSwapped reports whether a fiat/crypto trade's Buy and Sell
+// labels are inverted, using the fiat leg as the anchor: when the legs have
+// opposite signs, the negative one was sent. Trades between two fiat or two
+// crypto legs, or whose signs carry no direction, are never swapped.
+func (c *Converter) fiatSidesSwapped(trade *TradePair) bool {
+	buyFiat, sellFiat := c.isFiat(trade.BuyLegs[0].Asset), c.isFiat(trade.SellLegs[0].Asset)
+	if buyFiat == sellFiat {
+		return false
+	}
+	buy, sell := signedTotal(trade.BuyLegs), signedTotal(trade.SellLegs)
+	if buy.Sign() == 0 || sell.Sign() == 0 || buy.Sign() == sell.Sign() {
+		return false
+	}
+	// The fiat leg is received while negative, or sent while positive
+	if buyFiat {
+		return buy.Sign() < 0
+	}
+	return sell.Sign() > 0
+}
+
+// signedTotal sums a side's fill amounts, keeping their signs.
+func signedTotal(legs []*K33Record) *big.Rat {
+	total := new(big.Rat)
+	for _, leg := range legs {
+		if amount, err := parseAmount(leg.Amount); err == nil {
+			total.Add(total, amount)
+		}
 	}
+	return total
 }
 
-func convertTimestamp(timestamp string) string {
-	// Parse: "2025/02/26 11:11:13"
-	t, err := time.Parse("2006/01/02 15:04:05", timestamp)
+// tradeNetWorth returns the fiat value of a trade from its buy fills'
+// Fiat Value column, in their Fiat Currency or c.FiatValueCurrency. It
+// returns empty values unless every buy fill has a value in one currency.
+func (c *Converter) tradeNetWorth(trade *TradePair) (amount, currency string) {
+	total := new(big.Rat)
+	for _, leg := range trade.BuyLegs {
+		if leg.FiatValue == "" {
+			return "", ""
+		}
+		value, err := parseAmount(leg.FiatValue)
+		if err != nil {
+			c.warnf("Ignoring invalid fiat value %q on trade %s", leg.FiatValue, trade.TradeID)
+			return "", ""
+		}
+		legCurrency := strings.ToUpper(strings.TrimSpace(leg.FiatCurrency))
+		if legCurrency == "" {
+			legCurrency = c.FiatValueCurrency
+		}
+		if currency != "" && legCurrency != currency {
+			c.warnf("Trade %s buy fills are valued in both %s and %s; leaving net worth empty", trade.TradeID, currency, legCurrency)
+			return "", ""
+		}
+		currency = legCurrency
+		total.Add(total, value.Abs(value))
+	}
+	if currency == "" {
+		return "", ""
+	}
+	return formatAmount(total), currency
+}
+
+// tradeTxHash returns the on-chain hash of a settled trade from its legs'
+// Deposit/Withdrawal tx columns, preferring the sell side and warning
+// when the two sides disagree.
+func (c *Converter) tradeTxHash(trade *TradePair) string {
+	sideHash := func(legs []*K33Record) string {
+		for _, leg := range legs {
+			for _, hash := range []string{leg.WithdrawalTxhash, leg.DepositTxhash} {
+				if hash != "" {
+					return hash
+				}
+			}
+		}
+		return ""
+	}
+	sell, buy := sideHash(trade.SellLegs), sideHash(trade.BuyLegs)
+	if sell != "" && buy != "" && sell != buy {
+		c.warnf("Trade %s legs have different tx hashes %s and %s; using the sell leg's", trade.TradeID, sell, buy)
+	}
+	if sell != "" {
+		return sell
+	}
+	return buy
+}
+
+// tradeTimestamp dates a trade by the leg c.TradeTime selects, taking the
+// first fill of each side, and warns when the legs' timestamps differ. If
+// either leg's timestamp cannot be parsed, the first leg's timestamp is
+// kept. It also returns the instant the date was formatted from.
+func (c *Converter) tradeTimestamp(trade *TradePair) (string, time.Time) {
+	buy, buyErr := parseTimestamp(trade.BuyLegs[0].Timestamp)
+	sell, sellErr := parseTimestamp(trade.SellLegs[0].Timestamp)
+	if buyErr != nil || sellErr != nil {
+		return trade.Timestamp, trade.at
+	}
+
+	at := trade.at
+	switch c.TradeTime {
+	case TradeTimeBuy:
+		at = buy
+	case TradeTimeSell:
+		at = sell
+	case TradeTimeEarliest:
+		at = earliest(buy, sell)
+	case TradeTimeLatest:
+		at = latest(buy, sell)
+	}
+	date := trade.Timestamp
+	if !at.IsZero() {
+		date = c.formatTime(at)
+	}
+	if !buy.Equal(sell) {
+		c.warnf("Trade %s legs are %v apart (buy %s, sell %s); dating it %s",
+			trade.TradeID, latest(buy, sell).Sub(earliest(buy, sell)),
+			trade.BuyLegs[0].Timestamp, trade.SellLegs[0].Timestamp, date)
+	}
+	return date, at
+}
+
+// formatTime formats t as an output Date in the output time zone.
+func (c *Converter) formatTime(t time.Time) string {
+	return t.In(c.location()).Format(koinlyTimeLayout)
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// applyZeroLegPolicy rewrites or drops a trade record whose sent or
+// received amount is zero, according to c.ZeroLegPolicy.
+func (c *Converter) applyZeroLegPolicy(record KoinlyRecord) []KoinlyRecord {
+	sentZero := isZeroAmount(record.SentAmount)
+	receivedZero := isZeroAmount(record.ReceivedAmount)
+	if !sentZero && !receivedZero {
+		return []KoinlyRecord{record}
+	}
+
+	switch c.ZeroLegPolicy {
+	case ZeroLegSkip:
+		c.warnf("Skipping trade with zero-amount leg: %s", record.Description)
+		return nil
+	case ZeroLegTransfer:
+		if sentZero {
+			record.SentAmount, record.SentCurrency = "", ""
+		}
+		if receivedZero {
+			record.ReceivedAmount, record.ReceivedCurrency = "", ""
+		}
+	}
+	return []KoinlyRecord{record}
+}
+
+// defaultFeeCurrency infers the currency of a trade fee the export left
+// blank, per c.FeeCurrency, from the sides as written after any
+// fiatSidesSwapped correction. It is empty when the chosen leg is missing.
+func (c *Converter) defaultFeeCurrency(trade *TradePair) string {
+	sell, buy := trade.SellLegs, trade.BuyLegs
+	if len(sell) > 0 && len(buy) > 0 && c.fiatSidesSwapped(trade) {
+		sell, buy = buy, sell
+	}
+	legs := sell
+	switch c.FeeCurrency {
+	case "", FeeCurrencySell:
+	case FeeCurrencyBuy:
+		legs = buy
+	default:
+		return c.FeeCurrency
+	}
+	if len(legs) == 0 {
+		return ""
+	}
+	return legs[0].Asset
+}
+
+// koinlyTimeLayout is the Date format Koinly expects, e.g. "2006-01-02 15:04:05".
+const koinlyTimeLayout = "2006-01-02 15:04:05"
+
+// k33TimeLayouts are the timestamp layouts K33 exports have used.
+var k33TimeLayouts = []string{
+	"2006/01/02 15:04:05", // 2025/02/26 11:11:13
+	time.RFC3339,          // 2025-02-26T11:11:13Z, 2025-02-26T12:11:13+01:00
+	"2006-01-02T15:04:05", // 2025-02-26T11:11:13
+	"2006-01-02 15:04:05", // 2025-02-26 11:11:13
+}
+
+// parseTimestamp parses a K33 "Timestamp (UTC)" value, trying each of
+// k33TimeLayouts in order. Fractional seconds ("11:11:13.250") are accepted
+// by every layout, and timestamps without a zone are taken as UTC.
+func parseTimestamp(timestamp string) (time.Time, error) {
+	for _, layout := range k33TimeLayouts {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no known timestamp layout matches %q", timestamp)
+}
+
+func (c *Converter) convertTimestamp(timestamp string) string {
+	t, err := parseTimestamp(timestamp)
 	if err != nil {
-		log.Printf("Warning: Could not parse timestamp %s: %v", timestamp, err)
+		c.warnf("Could not parse timestamp %s: %v", timestamp, err)
 		return timestamp
 	}
-	
-	// Format: "2006-01-02 15:04:05"
-	return t.Format("2006-01-02 15:04:05")
-}
\ No newline at end of file
+
+	return c.formatTime(t)
+}
+
+// location is the zone output dates are written in: c.Location, or UTC.
+func (c *Converter) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// LoadLocation loads the named time zone for Location, falling back to UTC
+// with a warning when the name is not a known zone.
+func LoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Warning: Unknown time zone %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
@@ -1,8 +1,14 @@
 package converter
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConvertTimestamp(t *testing.T) {
@@ -12,16 +18,58 @@ func TestConvertTimestamp(t *testing.T) {
 	}{
 		{"2023/01/15 10:30:45", "2023-01-15 10:30:45"},
 		{"2023/12/25 23:59:59", "2023-12-25 23:59:59"},
+		{"2025-02-26T11:11:13Z", "2025-02-26 11:11:13"},
+		{"2025-02-26T12:11:13+01:00", "2025-02-26 11:11:13"},
+		{"2025-02-26T11:11:13", "2025-02-26 11:11:13"},
+		{"2025-02-26T11:11:13.250Z", "2025-02-26 11:11:13"},
+		{"2025/02/26 11:11:13.250", "2025-02-26 11:11:13"},
+		{"2025-02-26 11:11:13", "2025-02-26 11:11:13"},
+		{"26.02.2025 11:11", "26.02.2025 11:11"}, // unknown layout passed through
 	}
 
 	for _, test := range tests {
-		result := convertTimestamp(test.input)
+		result := New().convertTimestamp(test.input)
 		if result != test.expected {
 			t.Errorf("convertTimestamp(%s) = %s, want %s", test.input, result, test.expected)
 		}
 	}
 }
 
+func TestTimeZone(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/15 10:30:45
+Trade,1,Sell,-0.5,Filled,BTC,2023/07/01 23:30:00
+Trade,1,Buy,1000,Filled,USD,2023/07/01 23:30:00`
+
+	conv := New()
+	conv.Location = LoadLocation("Europe/Oslo")
+	conv.TradeTime = TradeTimeBuy
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	// CET in winter, CEST across midnight in summer
+	if records[0].Date != "2023-01-15 11:30:45" {
+		t.Errorf("Winter date = %s, want 2023-01-15 11:30:45", records[0].Date)
+	}
+	if records[1].Date != "2023-07-02 01:30:00" {
+		t.Errorf("Summer date = %s, want 2023-07-02 01:30:00", records[1].Date)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	if loc := LoadLocation("Not/AZone"); loc != time.UTC {
+		t.Errorf("LoadLocation(invalid) = %v, want UTC", loc)
+	}
+	if !strings.Contains(logs.String(), `Unknown time zone "Not/AZone", using UTC`) {
+		t.Errorf("want an unknown zone warning, got logs:\n%s", logs.String())
+	}
+}
+
 func TestFormatTradeID(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -29,8 +77,9 @@ func TestFormatTradeID(t *testing.T) {
 	}{
 		{"1000000012345", "1000000012345"},
 		{"1.000000012345e+12", "1000000012345"},
-		{"9007199254740993", "9007199254740993"},       // exceeds float64 precision
-		{"9.007199254740993e+15", "9007199254740993"},   // scientific notation, exceeds float64 precision
+		{"9007199254740993", "9007199254740993"},      // exceeds float64 precision
+		{"9.007199254740993e+15", "9007199254740993"}, // scientific notation, exceeds float64 precision
+		{"1.0000000123451e+12", "1000000012345.1"},    // not an integer: keep the full value
 		{"", ""},
 	}
 
@@ -47,10 +96,10 @@ func TestProcessK33Record(t *testing.T) {
 
 	// Test deposit
 	deposit := K33Record{
-		TypeStatus: "Deposit Complete",
-		Amount:     "1000",
-		Asset:      "USD",
-		Timestamp:  "2023/01/15 10:30:45",
+		TypeStatus:    "Deposit Complete",
+		Amount:        "1000",
+		Asset:         "USD",
+		Timestamp:     "2023/01/15 10:30:45",
 		DepositTxhash: "0xabc123",
 	}
 
@@ -66,10 +115,10 @@ func TestProcessK33Record(t *testing.T) {
 
 	// Test withdrawal
 	withdrawal := K33Record{
-		TypeStatus: "Withdrawal Complete",
-		Amount:     "-500",
-		Asset:      "USD",
-		Timestamp:  "2023/01/16 14:20:30",
+		TypeStatus:       "Withdrawal Complete",
+		Amount:           "-500",
+		Asset:            "USD",
+		Timestamp:        "2023/01/16 14:20:30",
 		WithdrawalTxhash: "0xdef456",
 	}
 
@@ -114,7 +163,11 @@ func TestTradePairing(t *testing.T) {
 		Timestamp:   "2023/01/15 10:30:45",
 	}
 
-	records = conv.processK33Record(sellLeg)
+	// The trade stays open for further fills until its rows end
+	if records = conv.processK33Record(sellLeg); len(records) != 0 {
+		t.Errorf("Expected the trade to wait for further fills, got %d records", len(records))
+	}
+	records = conv.settleFilled(nil)
 	if len(records) != 1 {
 		t.Fatalf("Expected 1 record for complete trade, got %d", len(records))
 	}
@@ -209,4 +262,857 @@ func TestDryRunProducesSameRecords(t *testing.T) {
 	if recordLines != expectedRecords {
 		t.Errorf("DryRun produced %d records, Process produced %d", recordLines, expectedRecords)
 	}
-}
\ No newline at end of file
+}
+
+func TestInlineTradeFee(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,42,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,-0.001,BTC
+Trade,42,Buy,1000,Filled,USD,2023/01/15 10:30:45,,`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 trade record, got %d", len(records))
+	}
+
+	record := records[0]
+	if record.FeeAmount != "0.001" || record.FeeCurrency != "BTC" {
+		t.Errorf("Trade fee = %s %s, want 0.001 BTC", record.FeeAmount, record.FeeCurrency)
+	}
+}
+
+func TestTradeFeeCurrencyDefault(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,42,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,,
+Trade,42,Buy,1000,Filled,USD,2023/01/15 10:30:45,-2,`
+
+	tests := []struct {
+		feeCurrency string
+		want        string
+	}{
+		{"", "BTC"},
+		{FeeCurrencyBuy, "USD"},
+		{"NOK", "NOK"},
+	}
+	for _, test := range tests {
+		conv := New()
+		conv.FeeCurrency = test.feeCurrency
+		records, err := conv.parseRecords(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseRecords failed: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 trade record, got %d", len(records))
+		}
+		if r := records[0]; r.FeeAmount != "2" || r.FeeCurrency != test.want {
+			t.Errorf("FeeCurrency %q: fee = %s %s, want 2 %s", test.feeCurrency, r.FeeAmount, r.FeeCurrency, test.want)
+		}
+	}
+
+	// Sides swapped by the fiat leg's sign: the default follows the BTC
+	// actually sent
+	swapped := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,43,Sell,1000,Filled,USD,2023/01/15 10:30:45,-2,
+Trade,43,Buy,-0.5,Filled,BTC,2023/01/15 10:30:45,,`
+	conv := New()
+	conv.LogLevel = LogQuiet
+	records, err := conv.parseRecords(strings.NewReader(swapped))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].SentCurrency != "BTC" || records[0].FeeCurrency != "BTC" {
+		t.Errorf("swapped trade = %+v, want BTC sent with the fee in BTC", records)
+	}
+}
+
+func TestTeeJSONMatchesCSVRows(t *testing.T) {
+	output := &strings.Builder{}
+	tee := &strings.Builder{}
+	conv := New()
+	conv.TeeJSON = tee
+
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	csvRows := len(strings.Split(strings.TrimSpace(output.String()), "\n")) - 1
+	jsonRows := len(strings.Split(strings.TrimSpace(tee.String()), "\n"))
+	if jsonRows != csvRows {
+		t.Errorf("Tee produced %d JSON lines, CSV has %d rows", jsonRows, csvRows)
+	}
+	if !strings.Contains(tee.String(), `"description":"Fiat Withdrawal (K33)"`) {
+		t.Errorf("Tee output missing withdrawal record: %s", tee.String())
+	}
+}
+
+func TestStrictDepositStatus(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,100,USD,2023/01/15 10:30:45
+Deposit In Review,200,USD,2023/01/16 10:30:45`
+
+	conv := New()
+	conv.StrictDepositStatus = true
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ReceivedAmount != "100" {
+		t.Fatalf("Expected only the complete deposit, got %+v", records)
+	}
+	if conv.skippedDeposits != 1 {
+		t.Errorf("skippedDeposits = %d, want 1", conv.skippedDeposits)
+	}
+
+	// Without the option both deposits are imported
+	records, err = New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected 2 deposits without strict status, got %d", len(records))
+	}
+}
+
+func TestZeroLegPolicy(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,7,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,7,Buy,0,Filled,USD,2023/01/15 10:30:45`
+
+	tests := []struct {
+		policy       ZeroLegPolicy
+		wantRecords  int
+		wantReceived string
+		wantCurrency string
+	}{
+		{ZeroLegEmit, 1, "0", "USD"},
+		{ZeroLegSkip, 0, "", ""},
+		{ZeroLegTransfer, 1, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			conv := New()
+			conv.ZeroLegPolicy = test.policy
+			records, err := conv.parseRecords(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("parseRecords failed: %v", err)
+			}
+			if len(records) != test.wantRecords {
+				t.Fatalf("Expected %d records, got %d", test.wantRecords, len(records))
+			}
+			if len(records) == 0 {
+				return
+			}
+			r := records[0]
+			if r.ReceivedAmount != test.wantReceived || r.ReceivedCurrency != test.wantCurrency {
+				t.Errorf("Received = %q %q, want %q %q", r.ReceivedAmount, r.ReceivedCurrency, test.wantReceived, test.wantCurrency)
+			}
+			if r.SentAmount != "0.5" || r.SentCurrency != "BTC" {
+				t.Errorf("Sent = %s %s, want 0.5 BTC", r.SentAmount, r.SentCurrency)
+			}
+		})
+	}
+}
+
+func TestSkipRecordTypes(t *testing.T) {
+	conv := New()
+	conv.SkipWithdrawals = true
+
+	records, err := conv.parseRecords(strings.NewReader(testCSVInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected only the trade record, got %d", len(records))
+	}
+	if !strings.HasPrefix(records[0].Description, "Trade (K33)") {
+		t.Errorf("Expected trade record, got %s", records[0].Description)
+	}
+}
+
+func TestZeroFillAmounts(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,100,USD,2023/01/15 10:30:45`
+
+	output := &strings.Builder{}
+	conv := New()
+	conv.ZeroFillAmounts = true
+	if err := conv.Process(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	expected := "2023-01-15 10:30:45,0,,100,USD,0,,,,,Fiat Deposit (K33),"
+	if len(lines) != 2 || lines[1] != expected {
+		t.Errorf("Zero-filled row = %q, want %q", lines[len(lines)-1], expected)
+	}
+}
+
+func TestScientificTradeIDsDoNotCollide(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1.0000000123451e+12,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1.0000000123454e+12,Sell,-0.1,Filled,ETH,2023/01/15 10:30:45
+Trade,1.0000000123451e+12,Buy,1000,Filled,USD,2023/01/15 10:30:45
+Trade,1.0000000123454e+12,Buy,200,Filled,USD,2023/01/15 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 distinct trades, got %d", len(records))
+	}
+	if records[0].SentCurrency != "BTC" || records[0].ReceivedAmount != "1000" {
+		t.Errorf("First trade mis-paired: %+v", records[0])
+	}
+	if records[1].SentCurrency != "ETH" || records[1].ReceivedAmount != "200" {
+		t.Errorf("Second trade mis-paired: %+v", records[1])
+	}
+}
+
+func TestPairingByOrderID(t *testing.T) {
+	input := `Type/Status,TradeID,Order Ref,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,101,9001,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,102,9001,Buy,1000,Filled,USD,2023/01/15 10:30:45
+Trade,103,,Sell,-1,Filled,ETH,2023/01/16 10:30:45
+Trade,103,,Buy,200,Filled,USD,2023/01/16 10:30:45`
+
+	conv := New()
+	conv.Columns = map[string]string{"OrderID": "Order Ref"}
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 trades, got %d: %+v", len(records), records)
+	}
+	if r := records[0]; r.SentCurrency != "BTC" || r.ReceivedAmount != "1000" || r.Description != "Trade (K33) - 9001" {
+		t.Errorf("OrderID trade mis-paired: %+v", r)
+	}
+	if r := records[1]; r.SentCurrency != "ETH" || r.Description != "Trade (K33) - 103" {
+		t.Errorf("TradeID fallback mis-paired: %+v", r)
+	}
+}
+
+func TestTradeTime(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:47
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45`
+
+	tests := []struct {
+		mode TradeTime
+		want string
+	}{
+		{TradeTimeFirst, "2023-01-15 10:30:47"},
+		{TradeTimeBuy, "2023-01-15 10:30:47"},
+		{TradeTimeSell, "2023-01-15 10:30:45"},
+		{TradeTimeEarliest, "2023-01-15 10:30:45"},
+		{TradeTimeLatest, "2023-01-15 10:30:47"},
+	}
+	for _, test := range tests {
+		conv := New()
+		conv.TradeTime = test.mode
+		records, err := conv.parseRecords(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseRecords failed: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 trade, got %d", len(records))
+		}
+		if records[0].Date != test.want {
+			t.Errorf("TradeTime %s: Date = %s, want %s", test.mode, records[0].Date, test.want)
+		}
+	}
+}
+
+func TestMismatchedLegTimestamps(t *testing.T) {
+	buyFirst := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:47
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45`
+	sellFirst := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:47`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// The default dates the trade the same whichever leg is exported first
+	for _, input := range []string{buyFirst, sellFirst} {
+		logs.Reset()
+		conv := New()
+		records, err := conv.parseRecords(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseRecords failed: %v", err)
+		}
+		if len(records) != 1 || records[0].Date != "2023-01-15 10:30:47" {
+			t.Errorf("records = %+v, want one trade dated 2023-01-15 10:30:47", records)
+		}
+		want := "Trade 1 legs are 2s apart (buy 2023/01/15 10:30:47, sell 2023/01/15 10:30:45); dating it 2023-01-15 10:30:47"
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("want a mismatch warning %q, got logs:\n%s", want, logs.String())
+		}
+	}
+
+	logs.Reset()
+	if _, err := New().parseRecords(strings.NewReader(strings.ReplaceAll(buyFirst, "10:30:47", "10:30:45"))); err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if strings.Contains(logs.String(), "apart") {
+		t.Errorf("want no warning for legs with one timestamp, got logs:\n%s", logs.String())
+	}
+}
+
+func TestSignConventionBothNegative(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,-1000,Filled,USD,2023/01/15 10:30:45`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	conv.SignConvention = SignNegative
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].SentAmount != "0.5" || records[0].ReceivedAmount != "1000" {
+		t.Fatalf("Both-negative trade converted wrongly: %+v", records)
+	}
+	if strings.Contains(logs.String(), "sign convention") {
+		t.Errorf("Unexpected sign warning under the negative convention:\n%s", logs.String())
+	}
+
+	// The default convention flags the negative buy leg
+	logs.Reset()
+	if _, err := New().parseRecords(strings.NewReader(input)); err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if n := strings.Count(logs.String(), "sign convention"); n != 1 {
+		t.Errorf("Expected 1 sign warning under the opposite convention, got %d:\n%s", n, logs.String())
+	}
+}
+
+func TestForkDeposit(t *testing.T) {
+	conv := New()
+	fork := K33Record{
+		TypeStatus: "Fork Deposit Complete",
+		Amount:     "1.5",
+		Asset:      "BCH",
+		Timestamp:  "2023/01/15 10:30:45",
+	}
+
+	records := conv.processK33Record(fork)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record for fork, got %d", len(records))
+	}
+	r := records[0]
+	if r.ReceivedAmount != "1.5" || r.ReceivedCurrency != "BCH" || r.SentAmount != "" {
+		t.Errorf("Fork conversion failed: got %+v", r)
+	}
+	if r.Label != "fork" {
+		t.Errorf("Fork label = %q, want fork", r.Label)
+	}
+}
+
+func TestStakingLockVsReward(t *testing.T) {
+	conv := New()
+	lock := K33Record{
+		TypeStatus: "Staking Deposit Complete",
+		Amount:     "-32",
+		Asset:      "ETH",
+		Timestamp:  "2023/01/15 10:30:45",
+	}
+	unlock := K33Record{
+		TypeStatus: "Staking Withdrawal Complete",
+		Amount:     "32",
+		Asset:      "ETH",
+		Timestamp:  "2023/02/15 10:30:45",
+	}
+	reward := K33Record{
+		TypeStatus: "Staking Reward",
+		Amount:     "0.01",
+		Asset:      "ETH",
+		Timestamp:  "2023/02/01 10:30:45",
+	}
+
+	records := conv.processK33Record(lock)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record for staking lock, got %d", len(records))
+	}
+	r := records[0]
+	if r.SentAmount != "32" || r.SentCurrency != "ETH" || r.ReceivedAmount != "" {
+		t.Errorf("Staking lock conversion failed: got %+v", r)
+	}
+	if r.Label != "" {
+		t.Errorf("Staking lock label = %q, want none", r.Label)
+	}
+
+	records = conv.processK33Record(unlock)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record for staking unlock, got %d", len(records))
+	}
+	r = records[0]
+	if r.ReceivedAmount != "32" || r.ReceivedCurrency != "ETH" || r.Label != "" {
+		t.Errorf("Staking unlock conversion failed: got %+v", r)
+	}
+
+	for _, r := range conv.processK33Record(reward) {
+		if r.kind == "staking" || r.SentAmount != "" {
+			t.Errorf("Staking reward treated as a lock: %+v", r)
+		}
+	}
+}
+
+func TestRewardLabel(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Staking Reward,0.01,ETH,2023/02/01 10:30:45
+Earn Reward Deposit,1.5,USDC,2023/02/02 10:30:45
+Staking Deposit Complete,-32,ETH,2023/02/03 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+
+	for i, want := range []struct{ amount, currency string }{{"0.01", "ETH"}, {"1.5", "USDC"}} {
+		r := records[i]
+		if r.ReceivedAmount != want.amount || r.ReceivedCurrency != want.currency || r.SentAmount != "" {
+			t.Errorf("Reward %d = %s %s, want %s %s received", i, r.ReceivedAmount, r.ReceivedCurrency, want.amount, want.currency)
+		}
+		if r.Label != "reward" {
+			t.Errorf("Reward %d label = %q, want reward", i, r.Label)
+		}
+	}
+	if records[2].Label != "" || records[2].SentAmount != "32" {
+		t.Errorf("Staking lock should stay an unlabeled transfer: %+v", records[2])
+	}
+}
+
+func TestInterestLabel(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Interest,12.34,NOK,2023/02/01 00:00:00
+Interest Deposit Complete,0.002,BTC,2023/02/02 00:00:00`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	for i, want := range []struct{ amount, currency string }{{"12.34", "NOK"}, {"0.002", "BTC"}} {
+		r := records[i]
+		if r.ReceivedAmount != want.amount || r.ReceivedCurrency != want.currency || r.SentAmount != "" {
+			t.Errorf("Interest %d = %s %s, want %s %s received", i, r.ReceivedAmount, r.ReceivedCurrency, want.amount, want.currency)
+		}
+		if r.Label != "interest" {
+			t.Errorf("Interest %d label = %q, want interest", i, r.Label)
+		}
+		if r.Description != "Interest (K33)" {
+			t.Errorf("Interest %d description = %q, want Interest (K33)", i, r.Description)
+		}
+	}
+	if got := conv.Stats(); got.Interest != 2 || got.Unrecognized != 0 || got.Deposits != 0 {
+		t.Errorf("Stats = %+v, want 2 interest payouts", got)
+	}
+}
+
+func TestDepositFeeFromGrossAndNet(t *testing.T) {
+	input := `Type/Status,Amount,Gross Amount,Net Amount,Asset,Timestamp (UTC)
+Deposit Complete,0.999,1.0,0.999,BTC,2023/01/15 10:30:45
+Deposit Complete,2,2,2,BTC,2023/01/16 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 deposits, got %d", len(records))
+	}
+
+	r := records[0]
+	if r.ReceivedAmount != "0.999" || r.ReceivedCurrency != "BTC" {
+		t.Errorf("Received = %s %s, want 0.999 BTC", r.ReceivedAmount, r.ReceivedCurrency)
+	}
+	if r.FeeAmount != "0.001" || r.FeeCurrency != "BTC" {
+		t.Errorf("Fee = %s %s, want 0.001 BTC", r.FeeAmount, r.FeeCurrency)
+	}
+	if records[1].FeeAmount != "" {
+		t.Errorf("Expected no fee when gross equals net, got %s", records[1].FeeAmount)
+	}
+}
+
+func TestAmountBasis(t *testing.T) {
+	input := `Type/Status,Amount,Gross Amount,Net Amount,Asset,Timestamp (UTC)
+Deposit Complete,0.999,1.0,0.999,BTC,2023/01/15 10:30:45
+Withdrawal Complete,-1.98,-2.0,-1.98,ETH,2023/01/16 10:30:45`
+
+	for basis, want := range map[AmountBasis][2]string{AmountBasisNet: {"0.999", "1.98"}, AmountBasisGross: {"1", "2"}} {
+		conv := New()
+		conv.AmountBasis = basis
+		records, err := conv.parseRecords(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseRecords failed: %v", err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("Expected a deposit and a withdrawal, got %d", len(records))
+		}
+		if r := records[0]; r.ReceivedAmount != want[0] || r.FeeAmount != "0.001" {
+			t.Errorf("AmountBasis %s: received %s, fee %s; want %s with fee 0.001", basis, r.ReceivedAmount, r.FeeAmount, want[0])
+		}
+		if r := records[1]; r.SentAmount != want[1] || r.FeeAmount != "0.02" || r.FeeCurrency != "ETH" {
+			t.Errorf("AmountBasis %s: sent %s, fee %s %s; want %s with fee 0.02 ETH", basis, r.SentAmount, r.FeeAmount, r.FeeCurrency, want[1])
+		}
+	}
+}
+
+func TestUniqueKeyCollisionAcrossTypes(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),UniqueKey
+Deposit Complete,,,100,,USD,2023/01/14 10:30:45,dup1
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,dup1
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45,dup1`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected deposit and trade to both convert, got %d records", len(records))
+	}
+	// The two trade legs sharing a key are not a collision; the deposit is
+	if n := strings.Count(logs.String(), "UniqueKey dup1 used by both deposit and trade rows"); n != 1 {
+		t.Errorf("want 1 collision warning, got %d in logs:\n%s", n, logs.String())
+	}
+}
+
+func TestHeaderOnlyInput(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	output := &strings.Builder{}
+	header := "Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)\n"
+	if err := New().Process(strings.NewReader(header), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(output.String()), "\n"); len(lines) != 1 {
+		t.Errorf("Expected only the Koinly header, got %q", output.String())
+	}
+	if !strings.Contains(logs.String(), "no data rows") {
+		t.Errorf("Missing header-only warning:\n%s", logs.String())
+	}
+
+	// Rows that are all dropped get a different warning
+	logs.Reset()
+	rejected := header + "Trade,1,Sell,-0.5,Reject,BTC,2023/01/15 10:30:45\n"
+	if err := New().Process(strings.NewReader(rejected), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if strings.Contains(logs.String(), "no data rows") || !strings.Contains(logs.String(), "None of the 1 data rows produced output") {
+		t.Errorf("Expected the all-dropped warning:\n%s", logs.String())
+	}
+}
+
+func TestPartialFills(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,400,Filled,USD,2023/01/15 10:30:45
+Trade,1,Buy,350.5,Filled,USD,2023/01/15 10:30:46
+Trade,1,Buy,249.5,Filled,USD,2023/01/15 10:30:47
+Trade,1,Buy,1,Filled,EUR,2023/01/15 10:30:48
+Trade,2,Sell,-1,Filled,ETH,2023/01/16 10:30:45
+Trade,2,Buy,1500,Filled,USD,2023/01/16 10:30:45`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 trades, got %d: %+v", len(records), records)
+	}
+	if r := records[0]; r.SentAmount != "0.5" || r.ReceivedAmount != "1000" || r.ReceivedCurrency != "USD" {
+		t.Errorf("Partial fills not summed: %+v", r)
+	}
+	if r := records[0]; r.Date != "2023-01-15 10:30:45" {
+		t.Errorf("Trade dated %s, want the first fill", r.Date)
+	}
+	if r := records[1]; r.SentAmount != "1" || r.ReceivedAmount != "1500" {
+		t.Errorf("Second trade = %+v", r)
+	}
+
+	// A fill in another asset is a data error, not part of the sum
+	rejects := conv.Rejects()
+	if len(rejects) != 1 || !strings.Contains(rejects[0].Reason, "Buy fills in both USD and EUR") {
+		t.Errorf("Rejects = %+v, want the EUR fill", rejects)
+	}
+}
+
+func TestAdjustment(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Balance Adjustment,0.25,BTC,2023/02/01 10:30:45
+Balance Adjustment,-10,USD,2023/02/02 10:30:45`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 adjustments, got %d", len(records))
+	}
+
+	if r := records[0]; r.ReceivedAmount != "0.25" || r.ReceivedCurrency != "BTC" || r.SentAmount != "" || r.Label != "adjustment" {
+		t.Errorf("Positive adjustment = %+v, want 0.25 BTC received labeled adjustment", r)
+	}
+	if r := records[1]; r.SentAmount != "10" || r.SentCurrency != "USD" || r.ReceivedAmount != "" || r.Label != "adjustment" {
+		t.Errorf("Negative adjustment = %+v, want 10 USD sent labeled adjustment", r)
+	}
+}
+
+func TestTradeTxHash(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),DepositTxhash,WithdrawalTxhash
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,,
+Trade,1,Buy,1000,Filled,USDC,2023/01/15 10:30:45,0xbuy,
+Trade,2,Sell,-0.5,Filled,BTC,2023/01/16 10:30:45,,0xsell
+Trade,2,Buy,1000,Filled,USDC,2023/01/16 10:30:45,0xother,
+Trade,3,Sell,-0.5,Filled,BTC,2023/01/17 10:30:45,,
+Trade,3,Buy,1000,Filled,USD,2023/01/17 10:30:45,,`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 trades, got %d", len(records))
+	}
+	for i, want := range []string{"0xbuy", "0xsell", ""} {
+		if records[i].TxHash != want {
+			t.Errorf("Trade %d TxHash = %q, want %q", i+1, records[i].TxHash, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "Trade 2 legs have different tx hashes") {
+		t.Errorf("Missing tx hash conflict warning:\n%s", logs.String())
+	}
+}
+
+func TestTradeNetWorthFromFiatValue(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Value
+Trade,1,Sell,-1000,Filled,USDC,2023/01/15 10:30:45,$1000.004
+Trade,1,Buy,0.05,Filled,BTC,2023/01/15 10:30:45,"€ 1,000.50"
+Trade,2,Sell,-1000,Filled,USDC,2023/01/15 10:31:45,1000
+Trade,2,Buy,0.05,Filled,BTC,2023/01/15 10:31:45,999.996
+Trade,3,Sell,-1000,Filled,USDC,2023/01/15 10:32:45,1000
+Trade,3,Buy,0.05,Filled,BTC,2023/01/15 10:32:45,`
+
+	conv := New()
+	conv.Columns = map[string]string{"Fiat Value": "Value"}
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	want := []struct{ amount, currency string }{
+		{"1000.5", "EUR"}, // the buy leg's value, not the sell leg's
+		{"1000", "USD"},   // no currency named, so FiatValueCurrency; rounded
+		{"", ""},          // buy leg has no value
+	}
+	for i, w := range want {
+		if got := records[i]; got.NetWorthAmount != w.amount || got.NetWorthCurrency != w.currency {
+			t.Errorf("trade %d net worth = %q %q, want %q %q", i+1, got.NetWorthAmount, got.NetWorthCurrency, w.amount, w.currency)
+		}
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	conv := New()
+	var out bytes.Buffer
+	err := conv.Process(strings.NewReader(""), &out)
+	if !errors.Is(err, ErrEmptyInput) || err.Error() != "input file is empty" {
+		t.Errorf("Process error = %v, want %v", err, ErrEmptyInput)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Process wrote %q for empty input", out.String())
+	}
+	if err := conv.ProcessDryRun(strings.NewReader(""), &out); !errors.Is(err, ErrEmptyInput) {
+		t.Errorf("ProcessDryRun error = %v, want %v", err, ErrEmptyInput)
+	}
+}
+
+func TestProcessAllPairsAcrossInputs(t *testing.T) {
+	january := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,1000,,USD,2023/01/15 10:30:45
+Trade,1,Sell,-1000,Filled,USD,2023/01/31 23:59:59`
+	february := `Timestamp (UTC),Type/Status,TradeID,Side,Amount,Trade Status,Asset
+2023/02/01 00:00:01,Trade,1,Buy,0.05,Filled,BTC`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	conv.TradeTime = TradeTimeFirst
+	var out bytes.Buffer
+	if err := conv.ProcessAll([]io.Reader{strings.NewReader(january), strings.NewReader(february)}, &out); err != nil {
+		t.Fatalf("ProcessAll failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != KoinlyHeader {
+		t.Fatalf("want one header and two rows, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[2], "2023-01-31 23:59:59,1000,USD,0.05,BTC,") {
+		t.Errorf("trade row = %s, want the legs from both inputs paired", lines[2])
+	}
+	if !strings.Contains(logs.String(), "Input 2 has a different header") {
+		t.Errorf("want a header mismatch warning, got logs:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "unpaired") {
+		t.Errorf("want no unpaired trades, got logs:\n%s", logs.String())
+	}
+}
+
+func TestFiatAnchoredSides(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Buy,-1000,Filled,USD,2023/01/15 10:30:45
+Trade,1,Sell,0.05,Filled,BTC,2023/01/15 10:30:45
+Trade,2,Sell,-0.05,Filled,BTC,2023/01/15 10:31:45
+Trade,2,Buy,1000,Filled,USD,2023/01/15 10:31:45
+Trade,3,Buy,-1,Filled,ETH,2023/01/15 10:32:45
+Trade,3,Sell,0.05,Filled,BTC,2023/01/15 10:32:45`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	want := []string{
+		"1000 USD -> 0.05 BTC", // mislabeled: the negative fiat leg was spent
+		"0.05 BTC -> 1000 USD", // labeled correctly
+		"0.05 BTC -> 1 ETH",    // no fiat leg to anchor on, labels kept
+	}
+	for i, w := range want {
+		r := records[i]
+		if got := r.SentAmount + " " + r.SentCurrency + " -> " + r.ReceivedAmount + " " + r.ReceivedCurrency; got != w {
+			t.Errorf("trade %d = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestConvertTwice(t *testing.T) {
+	first := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),UniqueKey
+Deposit Pending,,,100,,USD,2023/01/14 10:30:45,k1
+Airdrop Pending,,,5,,XYZ,2023/01/15 10:30:45,
+Trade,1,Buy,0.05,Filled,BTC,2023/01/16 10:30:45,`
+	second := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),UniqueKey
+Deposit Pending,,,100,,USD,2023/02/14 10:30:45,
+Airdrop Pending,,,5,,XYZ,2023/02/15 10:30:45,
+Trade,1,Sell,-1000,Filled,USD,2023/02/16 10:30:45,k1`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	conv.StrictDepositStatus = true
+	var unrecognized bytes.Buffer
+	conv.UnrecognizedReport = &unrecognized
+	if _, err := conv.Convert(strings.NewReader(first)); err != nil {
+		t.Fatalf("first Convert failed: %v", err)
+	}
+	logs.Reset()
+	unrecognized.Reset()
+	records, err := conv.Convert(strings.NewReader(second))
+	if err != nil {
+		t.Fatalf("second Convert failed: %v", err)
+	}
+
+	if len(records) != 0 {
+		t.Errorf("want the second run's sell leg left unpaired, got %+v", records)
+	}
+	if !strings.Contains(logs.String(), "Skipped 1 deposits with a non-final status") {
+		t.Errorf("want one skipped deposit in the second run, got logs:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "UniqueKey") {
+		t.Errorf("want no UniqueKey collision with the first run, got logs:\n%s", logs.String())
+	}
+	if !strings.Contains(unrecognized.String(), "Airdrop Pending,1,") {
+		t.Errorf("want the second run's unrecognized count alone, got:\n%s", unrecognized.String())
+	}
+	if got := conv.Stats().Rows; got != 3 {
+		t.Errorf("Rows = %d, want 3", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,1000,,USD,2023/01/15 10:30:45
+Trade,1,Sell,-1000,Filled,USD,2023/01/15 10:31:45
+Trade,1,Buy,0.05,Filled,BTC,2023/01/15 10:31:45
+Trade,2,Buy,0.05,Filled,BTC,2023/01/15 10:32:45`
+
+	records, err := New().Convert(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+	if len(records) != 2 || records[0].ReceivedAmount != "1000" || records[1].ReceivedCurrency != "BTC" {
+		t.Errorf("got %+v, want the deposit and trade 1", records)
+	}
+
+	conv := New()
+	conv.Strict = true
+	records, err = conv.Convert(strings.NewReader(input))
+	var unpaired *UnpairedTrades
+	if !errors.As(err, &unpaired) || len(records) != 2 {
+		t.Errorf("strict: got %d records and err %v, want 2 records and the unpaired trade", len(records), err)
+	}
+}
+
+func TestDuplicateSideWarning(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Buy,0.05,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,1000,Filled,BTC,2023/01/15 10:30:45
+Trade,2,Sell,-0.05,Filled,BTC,2023/01/15 10:31:45`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	if _, err := conv.parseRecords(strings.NewReader(input)); err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Trade 1 has 2 Buy rows (lines 2, 3) and no Sell row") {
+		t.Errorf("want a duplicate side warning for trade 1, got logs:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "Trade 2 has") {
+		t.Errorf("want no duplicate side warning for single-row trade 2, got logs:\n%s", logs.String())
+	}
+	if conv.unpaired.Count() != 2 {
+		t.Errorf("unpaired = %v, want both trades", &conv.unpaired)
+	}
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// CurrencyRegistry is a set of currency symbols known to the import target.
+type CurrencyRegistry map[string]bool
+
+// LoadCurrencyRegistry reads valid currency symbols from path, one per line
+// or separated by commas. Blank lines and lines starting with # are ignored.
+func LoadCurrencyRegistry(path string) (CurrencyRegistry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening currency registry: %w", err)
+	}
+	defer f.Close()
+
+	registry := make(CurrencyRegistry)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, symbol := range strings.Split(line, ",") {
+			if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+				registry[symbol] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading currency registry: %w", err)
+	}
+	return registry, nil
+}
+
+// checkCurrencies checks a record's currencies against c.Currencies,
+// warning once per unknown symbol.
+func (c *Converter) checkCurrencies(r KoinlyRecord) {
+	if c.Currencies == nil {
+		return
+	}
+	for _, currency := range []string{r.SentCurrency, r.ReceivedCurrency, r.FeeCurrency, r.NetWorthCurrency} {
+		if currency == "" || c.Currencies[strings.ToUpper(currency)] || slices.Contains(c.unknownCurrencies, currency) {
+			continue
+		}
+		c.unknownCurrencies = append(c.unknownCurrencies, currency)
+		c.warnf("Unknown currency %s on %s row at %s", currency, r.kind, r.Date)
+	}
+}
+
+// unknownCurrencyError fails a conversion that met unknown currencies when
+// StrictCurrencies is set. Rows are streamed, so they have been written.
+func (c *Converter) unknownCurrencyError() error {
+	if len(c.unknownCurrencies) > 0 && c.StrictCurrencies {
+		return fmt.Errorf("unknown currencies: %s", strings.Join(c.unknownCurrencies, ", "))
+	}
+	return nil
+}
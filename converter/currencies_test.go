@@ -0,0 +1,61 @@
+package converter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCurrencyRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "currencies.txt")
+	if err := os.WriteFile(path, []byte("# known symbols\nbtc\nETH, USD\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadCurrencyRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadCurrencyRegistry failed: %v", err)
+	}
+	for _, symbol := range []string{"BTC", "ETH", "USD"} {
+		if !registry[symbol] {
+			t.Errorf("registry missing %s", symbol)
+		}
+	}
+	if len(registry) != 3 {
+		t.Errorf("registry has %d symbols, want 3", len(registry))
+	}
+}
+
+func TestUnknownCurrencyWarns(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,1,BTC,2023/01/15 10:30:45
+Deposit Complete,2,BTCC,2023/01/16 10:30:45
+Deposit Complete,3,BTCC,2023/01/17 10:30:45`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	conv.Currencies = CurrencyRegistry{"BTC": true}
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("Expected unknown currencies to be kept with a warning, got %d records", len(records))
+	}
+	if n := strings.Count(logs.String(), "Unknown currency BTCC"); n != 1 {
+		t.Errorf("Expected one warning for BTCC, got %d:\n%s", n, logs.String())
+	}
+
+	conv = New()
+	conv.Currencies = CurrencyRegistry{"BTC": true}
+	conv.StrictCurrencies = true
+	if _, err := conv.parseRecords(strings.NewReader(input)); err == nil {
+		t.Error("Expected an error for unknown currency in strict mode")
+	}
+}
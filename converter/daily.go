@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"encoding/csv"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// dailyKey identifies one row of the daily summary.
+type dailyKey struct {
+	date  string // YYYY-MM-DD in the output time zone
+	asset string
+}
+
+// dailyTotals are the amounts of one asset moved on one day.
+type dailyTotals struct {
+	received, sent, fee *big.Rat
+}
+
+// addDaily adds r's received, sent and fee amounts to the totals for its
+// day.
+func (c *Converter) addDaily(totals map[dailyKey]*dailyTotals, r KoinlyRecord) {
+	date, _, _ := strings.Cut(r.Date, " ")
+	add := func(amount, currency string, pick func(*dailyTotals) *big.Rat) {
+		if amount == "" || currency == "" {
+			return
+		}
+		value, err := parseAmount(amount)
+		if err != nil {
+			c.warnf("Ignoring amount %q in daily summary: %v", amount, err)
+			return
+		}
+		key := dailyKey{date: date, asset: currency}
+		if totals[key] == nil {
+			totals[key] = &dailyTotals{received: new(big.Rat), sent: new(big.Rat), fee: new(big.Rat)}
+		}
+		sum := pick(totals[key])
+		sum.Add(sum, value)
+	}
+	add(r.ReceivedAmount, r.ReceivedCurrency, func(t *dailyTotals) *big.Rat { return t.received })
+	add(r.SentAmount, r.SentCurrency, func(t *dailyTotals) *big.Rat { return t.sent })
+	add(r.FeeAmount, r.FeeCurrency, func(t *dailyTotals) *big.Rat { return t.fee })
+}
+
+// writeDailySummary writes one CSV row per day and asset, sorted by date
+// then asset, with the totals received, sent and paid in fees and the net
+// change (received minus sent and fees).
+func writeDailySummary(out io.Writer, totals map[dailyKey]*dailyTotals) error {
+	keys := make([]dailyKey, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b dailyKey) int {
+		if c := strings.Compare(a.date, b.date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.asset, b.asset)
+	})
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write([]string{"Date", "Asset", "Received", "Sent", "Fee", "Net"}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		t := totals[key]
+		net := new(big.Rat).Sub(t.received, t.sent)
+		net.Sub(net, t.fee)
+		row := []string{key.date, key.asset, formatAmount(t.received), formatAmount(t.sent), formatAmount(t.fee), formatAmount(net)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,34 @@
+package converter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDailySummary(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Deposit Complete,,,1000,,USD,2023/01/15 09:00:00,,
+Trade,1,Sell,-500,Filled,USD,2023/01/15 10:00:00,,
+Trade,1,Buy,0.025,Filled,BTC,2023/01/15 10:00:00,1,USD
+Deposit Complete,,,0.5,,BTC,2023/01/15 23:59:59,,
+Withdrawal Complete,,,-0.2,,BTC,2023/01/16 08:00:00,,
+Deposit Complete,,,250.50,,USD,2023/01/16 12:00:00,,`
+
+	var summary bytes.Buffer
+	conv := New()
+	conv.DailySummary = &summary
+	if err := conv.Process(strings.NewReader(input), &bytes.Buffer{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	want := `Date,Asset,Received,Sent,Fee,Net
+2023-01-15,BTC,0.525,0,0,0.525
+2023-01-15,USD,1000,500,1,499
+2023-01-16,BTC,0,0.2,0,-0.2
+2023-01-16,USD,250.5,0,0,250.5
+`
+	if summary.String() != want {
+		t.Errorf("daily summary =\n%s\nwant\n%s", summary.String(), want)
+	}
+}
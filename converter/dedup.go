@@ -0,0 +1,30 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"strings"
+)
+
+// duplicate reports whether a record like r was already written in this
+// conversion, noting r as written otherwise. A TxHash is authoritative, so
+// records carrying one are keyed on it alone; the record type and label
+// still take part, since a trade's cost row shares the trade's hash.
+func (c *Converter) duplicate(r KoinlyRecord) bool {
+	var fields []string
+	if r.TxHash != "" {
+		fields = []string{"tx", r.kind, r.Label, r.TxHash}
+	} else {
+		fields = []string{"row", r.kind, r.Label, r.Date,
+			r.SentAmount, r.SentCurrency, r.ReceivedAmount, r.ReceivedCurrency,
+			r.FeeAmount, r.FeeCurrency}
+	}
+	key := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	if c.seen == nil {
+		c.seen = make(map[[sha256.Size]byte]bool)
+	}
+	if c.seen[key] {
+		return true
+	}
+	c.seen[key] = true
+	return false
+}
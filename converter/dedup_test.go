@@ -0,0 +1,54 @@
+package converter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	january := `Type/Status,Amount,Asset,Timestamp (UTC),DepositTxhash
+Deposit Complete,1000,USD,2023/01/31 10:00:00,
+Deposit Complete,0.5,BTC,2023/01/31 23:59:59,0xabc`
+	// February's export repeats the boundary rows; the BTC deposit is
+	// stamped a second later but carries the same hash.
+	february := `Type/Status,Amount,Asset,Timestamp (UTC),DepositTxhash
+Deposit Complete,1000,USD,2023/01/31 10:00:00,
+Deposit Complete,0.5,BTC,2023/02/01 00:00:00,0xabc
+Deposit Complete,1000,USD,2023/02/01 10:00:00,`
+
+	convert := func(dedup bool) (*Converter, []string) {
+		conv := New()
+		conv.Dedup = dedup
+		var out bytes.Buffer
+		if err := conv.ProcessAll([]io.Reader{strings.NewReader(january), strings.NewReader(february)}, &out); err != nil {
+			t.Fatalf("ProcessAll failed: %v", err)
+		}
+		return conv, strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	}
+
+	conv, rows := convert(true)
+	if len(rows) != 3 {
+		t.Fatalf("want 3 rows, got:\n%s", strings.Join(rows, "\n"))
+	}
+	for i, prefix := range []string{
+		"2023-01-31 10:00:00,,,1000,USD,",
+		"2023-01-31 23:59:59,,,0.5,BTC,",
+		"2023-02-01 10:00:00,,,1000,USD,",
+	} {
+		if !strings.HasPrefix(rows[i], prefix) {
+			t.Errorf("row %d = %s, want prefix %s", i, rows[i], prefix)
+		}
+	}
+	if got := conv.Stats().Duplicates; got != 2 {
+		t.Errorf("Duplicates = %d, want 2", got)
+	}
+	if !strings.Contains(conv.Stats().String(), "2 duplicates dropped") {
+		t.Errorf("summary %q does not count the duplicates", conv.Stats())
+	}
+
+	if _, rows := convert(false); len(rows) != 5 {
+		t.Errorf("without Dedup want all 5 rows, got %d", len(rows))
+	}
+}
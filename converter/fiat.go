@@ -0,0 +1,128 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// fiatCurrencies are the tickers treated as fiat money by default.
+var fiatCurrencies = map[string]bool{
+	"USD": true, "EUR": true, "NOK": true, "SEK": true, "DKK": true,
+	"GBP": true, "CHF": true, "JPY": true, "CAD": true, "AUD": true,
+}
+
+// DefaultFiatCurrencies returns a copy of the built-in fiat tickers, for
+// extending Converter.FiatCurrencies.
+func DefaultFiatCurrencies() map[string]bool {
+	return maps.Clone(fiatCurrencies)
+}
+
+// isFiat reports whether asset is a fiat currency.
+func (c *Converter) isFiat(asset string) bool {
+	currencies := c.FiatCurrencies
+	if currencies == nil {
+		currencies = fiatCurrencies
+	}
+	return currencies[strings.ToUpper(strings.TrimSpace(asset))]
+}
+
+// assetClass is "Fiat" or "Crypto", for descriptions telling fiat on and
+// off ramps apart from crypto transfers.
+func (c *Converter) assetClass(asset string) string {
+	if c.isFiat(asset) {
+		return "Fiat"
+	}
+	return "Crypto"
+}
+
+// roundAmount rounds a decimal amount string to places fractional digits,
+// halves away from zero, trimming trailing zeros. Empty or unparseable
+// values are returned unchanged.
+func roundAmount(amount string, places int) string {
+	if amount == "" {
+		return amount
+	}
+	r, err := parseAmount(amount)
+	if err != nil {
+		return amount
+	}
+	rounded, _ := r.SetString(r.FloatString(places))
+	return formatAmount(rounded)
+}
+
+// FiatRates holds daily exchange rates into the base currency, keyed by
+// the converted fiat currency and date.
+type FiatRates map[priceKey]*big.Rat
+
+// LoadFiatRates reads a rate CSV with the columns date,from,rate, where
+// date is YYYY-MM-DD and rate is the value of one unit of from in the base
+// currency. A header row is optional.
+func LoadFiatRates(in io.Reader) (FiatRates, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = 3
+
+	rates := make(FiatRates)
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading fiat rates: %w", err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(row[0]), "date") {
+			continue
+		}
+
+		date := strings.TrimSpace(row[0])
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("fiat rates line %d: invalid date %q", line, row[0])
+		}
+		rate, err := parseAmount(row[2])
+		if err != nil {
+			return nil, fmt.Errorf("fiat rates line %d: %w", line, err)
+		}
+		rates[priceKey{asset: strings.ToUpper(strings.TrimSpace(row[1])), date: date}] = rate
+	}
+}
+
+// mapFiatToBase converts a record's fiat Sent, Received, Fee and Net Worth
+// amounts into c.BaseFiat using c.FiatRates for the record's date. Amounts
+// without a rate are kept in their own currency, with a warning.
+func (c *Converter) mapFiatToBase(r *KoinlyRecord) {
+	t, err := time.Parse(koinlyTimeLayout, r.Date)
+	if err != nil {
+		return
+	}
+	date := t.Format(time.DateOnly)
+	for _, field := range []struct{ amount, currency *string }{
+		{&r.SentAmount, &r.SentCurrency},
+		{&r.ReceivedAmount, &r.ReceivedCurrency},
+		{&r.FeeAmount, &r.FeeCurrency},
+		{&r.NetWorthAmount, &r.NetWorthCurrency},
+	} {
+		currency := strings.ToUpper(*field.currency)
+		if *field.amount == "" || !c.isFiat(currency) || currency == c.BaseFiat {
+			continue
+		}
+		rate, ok := c.FiatRates[priceKey{asset: currency, date: date}]
+		if !ok {
+			c.warnf("No %s rate into %s on %s; keeping %s %s", currency, c.BaseFiat, date, *field.amount, currency)
+			continue
+		}
+		amount, err := parseAmount(*field.amount)
+		if err != nil {
+			continue
+		}
+		converted := formatAmount(amount.Mul(amount, rate))
+		if c.FiatPrecision >= 0 {
+			converted = roundAmount(converted, c.FiatPrecision)
+		}
+		*field.amount, *field.currency = converted, c.BaseFiat
+	}
+}
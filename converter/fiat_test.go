@@ -0,0 +1,109 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsFiat(t *testing.T) {
+	conv := New()
+	for _, asset := range []string{"USD", "eur", " NOK "} {
+		if !conv.isFiat(asset) {
+			t.Errorf("isFiat(%q) = false, want true", asset)
+		}
+	}
+	for _, asset := range []string{"BTC", "USDC", ""} {
+		if conv.isFiat(asset) {
+			t.Errorf("isFiat(%q) = true, want false", asset)
+		}
+	}
+}
+
+func TestRoundAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		places   int
+		expected string
+	}{
+		{"1000.456", 2, "1000.46"},
+		{"1000.455", 2, "1000.46"},
+		{"1000.4", 2, "1000.4"},
+		{"-0.125", 2, "-0.13"},
+		{"", 2, ""},
+		{"abc", 2, "abc"},
+	}
+
+	for _, test := range tests {
+		if result := roundAmount(test.input, test.places); result != test.expected {
+			t.Errorf("roundAmount(%s, %d) = %s, want %s", test.input, test.places, result, test.expected)
+		}
+	}
+}
+
+func TestFiatNetWorthRounding(t *testing.T) {
+	conv := New()
+	records := conv.finalize([]KoinlyRecord{
+		{Date: "2023-01-15 10:30:45", NetWorthAmount: "1000.456", NetWorthCurrency: "USD"},
+		{Date: "2023-01-15 10:30:45", NetWorthAmount: "0.123456789", NetWorthCurrency: "BTC"},
+	})
+
+	if records[0].NetWorthAmount != "1000.46" {
+		t.Errorf("USD net worth = %s, want 1000.46", records[0].NetWorthAmount)
+	}
+	if records[1].NetWorthAmount != "0.123456789" {
+		t.Errorf("Non-fiat net worth should be untouched, got %s", records[1].NetWorthAmount)
+	}
+}
+
+func TestMapFiatToBase(t *testing.T) {
+	rates, err := LoadFiatRates(strings.NewReader("date,from,rate\n2023-01-15,EUR,1.0825\n"))
+	if err != nil {
+		t.Fatalf("LoadFiatRates failed: %v", err)
+	}
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,1000.50,,EUR,2023/01/15 10:30:45
+Deposit Complete,,,1000,,EUR,2023/01/16 10:30:45`
+
+	conv := New()
+	conv.BaseFiat = "USD"
+	conv.FiatRates = rates
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if got := records[0]; got.ReceivedAmount != "1083.04" || got.ReceivedCurrency != "USD" {
+		t.Errorf("converted deposit = %s %s, want 1083.04 USD", got.ReceivedAmount, got.ReceivedCurrency)
+	}
+	// no rate for the second day, so the amount is kept as exported
+	if got := records[1]; got.ReceivedAmount != "1000" || got.ReceivedCurrency != "EUR" {
+		t.Errorf("unrated deposit = %s %s, want 1000 EUR", got.ReceivedAmount, got.ReceivedCurrency)
+	}
+}
+
+func TestFiatCryptoDescriptions(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,1000,NOK,2023/01/15 10:30:45
+Deposit Complete,0.5,BTC,2023/01/15 10:31:45
+Withdrawal Complete,-0.2,BTC,2023/01/15 10:32:45
+Withdrawal Complete,-500,PLN,2023/01/15 10:33:45`
+
+	conv := New()
+	conv.FiatCurrencies = DefaultFiatCurrencies()
+	conv.FiatCurrencies["PLN"] = true
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	want := []string{"Fiat Deposit (K33)", "Crypto Deposit (K33)", "Crypto Withdrawal (K33)", "Fiat Withdrawal (K33)"}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, w := range want {
+		if records[i].Description != w {
+			t.Errorf("record %d description = %q, want %q", i, records[i].Description, w)
+		}
+	}
+}
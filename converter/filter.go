@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration is like time.ParseDuration but also accepts a leading day
+// component, e.g. "90d" or "1d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	days, rest, found := strings.Cut(s, "d")
+	if !found {
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.ParseFloat(days, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	d := time.Duration(n * float64(24*time.Hour))
+
+	if rest != "" {
+		r, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += r
+	}
+	return d, nil
+}
+
+// inWindow reports whether a K33 timestamp falls inside the configured
+// time window: within Since of Now, and dated From through To in the
+// output time zone. Timestamps that cannot be parsed are kept, since there
+// is no way to tell which side of the window they belong on.
+func (c *Converter) inWindow(timestamp string) bool {
+	if c.Since <= 0 && c.From.IsZero() && c.To.IsZero() {
+		return true
+	}
+	t, err := parseTimestamp(timestamp)
+	if err != nil {
+		return true
+	}
+	if c.Since > 0 && t.Before(c.Now().Add(-c.Since)) {
+		return false
+	}
+	// koinlyTimeLayout dates compare lexically
+	date := t.In(c.location()).Format(time.DateOnly)
+	if !c.From.IsZero() && date < c.From.Format(time.DateOnly) {
+		return false
+	}
+	return c.To.IsZero() || date <= c.To.Format(time.DateOnly)
+}
+
+// tradeInWindow keeps a trade when any of its legs is inside the window,
+// warning when others fall outside it.
+func (c *Converter) tradeInWindow(trade *TradePair) bool {
+	in, out := 0, 0
+	for _, leg := range slices.Concat(trade.BuyLegs, trade.SellLegs) {
+		if c.inWindow(leg.Timestamp) {
+			in++
+		} else {
+			out++
+		}
+	}
+	if in > 0 && out > 0 {
+		c.warnf("Trade %s has legs on both sides of the time window; keeping the whole trade", trade.TradeID)
+	}
+	return in > 0
+}
+
+// keepAsset reports whether a record sends or receives one of c.Assets,
+// or true when no assets are set.
+func (c *Converter) keepAsset(r KoinlyRecord) bool {
+	if len(c.Assets) == 0 {
+		return true
+	}
+	return c.Assets[strings.ToUpper(r.SentCurrency)] || c.Assets[strings.ToUpper(r.ReceivedCurrency)]
+}
@@ -0,0 +1,117 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"720h", 720 * time.Hour},
+		{"90d", 90 * 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+	}
+
+	for _, test := range tests {
+		result, err := ParseDuration(test.input)
+		if err != nil {
+			t.Errorf("ParseDuration(%s) returned error: %v", test.input, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("ParseDuration(%s) = %s, want %s", test.input, result, test.expected)
+		}
+	}
+
+	for _, input := range []string{"", "xd", "3d4x", "-1d"} {
+		if _, err := ParseDuration(input); err == nil {
+			t.Errorf("ParseDuration(%q) expected error", input)
+		}
+	}
+}
+
+func TestSinceFiltersOldRows(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/01 10:00:00
+Deposit Complete,,,200,,USD,2023/03/20 10:00:00
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/02 10:00:00
+Trade,1,Buy,1000,Filled,USD,2023/01/02 10:00:00
+Trade,2,Sell,-0.1,Filled,BTC,2023/03/25 10:00:00
+Trade,2,Buy,200,Filled,USD,2023/03/25 10:00:00`
+
+	conv := New()
+	conv.Now = func() time.Time { return time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC) }
+	conv.Since = 30 * 24 * time.Hour
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records inside the window, got %d: %+v", len(records), records)
+	}
+	if records[0].ReceivedAmount != "200" {
+		t.Errorf("Expected recent deposit, got %+v", records[0])
+	}
+	if records[1].Description != "Trade (K33) - 2" {
+		t.Errorf("Expected recent trade, got %+v", records[1])
+	}
+}
+
+func TestAssetFilter(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/14 10:30:45
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,10,Filled,ETH,2023/01/15 10:30:45
+Trade,2,Sell,-0.5,Filled,BTC,2023/01/16 10:30:45
+Trade,2,Buy,1000,Filled,USD,2023/01/16 10:30:45
+Withdrawal Complete,,,-2,,ETH,2023/01/17 10:30:45`
+
+	conv := New()
+	conv.Assets = map[string]bool{"ETH": true}
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 ETH records, got %d: %+v", len(records), records)
+	}
+	for _, r := range records {
+		if r.SentCurrency != "ETH" && r.ReceivedCurrency != "ETH" {
+			t.Errorf("Record without ETH emitted: %+v", r)
+		}
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,1,,USD,2022/12/31 23:59:59
+Deposit Complete,,,2,,USD,2023/01/01 00:00:00
+Deposit Complete,,,3,,USD,2023/12/31 23:59:59
+Deposit Complete,,,4,,USD,2024/01/01 00:00:00
+Trade,1,Sell,-0.5,Filled,BTC,2023/12/31 23:59:58
+Trade,1,Buy,1000,Filled,USD,2024/01/01 00:00:01
+Trade,2,Sell,-0.1,Filled,BTC,2024/02/01 10:00:00
+Trade,2,Buy,200,Filled,USD,2024/02/01 10:00:00`
+
+	conv := New()
+	conv.From = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	conv.To = time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.ReceivedAmount)
+	}
+	// Both bounds are inclusive; the trade straddling To is kept whole
+	if want := "2,3,1000"; strings.Join(got, ",") != want {
+		t.Errorf("Kept received amounts %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package converter
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// finalize applies the per-record adjustments that run on every converted
+// record, whatever its type.
+func (c *Converter) finalize(records []KoinlyRecord) []KoinlyRecord {
+	for i := range records {
+		c.applyMinFee(&records[i])
+		if c.NetFee {
+			c.netFee(&records[i])
+		}
+		if c.Daily {
+			truncateToDay(&records[i])
+		}
+		if c.BaseFiat != "" {
+			c.mapFiatToBase(&records[i])
+		}
+		if c.RoundAmounts {
+			c.roundAmounts(&records[i])
+		}
+		if c.FiatPrecision >= 0 && c.isFiat(records[i].NetWorthCurrency) {
+			records[i].NetWorthAmount = roundAmount(records[i].NetWorthAmount, c.FiatPrecision)
+		}
+		c.truncateDescription(&records[i])
+		if c.tagging() {
+			records[i].Tag = c.tagFor(records[i])
+		}
+	}
+	return records
+}
+
+// roundAmounts rounds a record's Sent, Received and Fee amounts to the
+// precision of their currency, in exact decimal arithmetic so no digit
+// within the precision is lost.
+func (c *Converter) roundAmounts(r *KoinlyRecord) {
+	for _, field := range []struct{ amount, currency *string }{
+		{&r.SentAmount, &r.SentCurrency},
+		{&r.ReceivedAmount, &r.ReceivedCurrency},
+		{&r.FeeAmount, &r.FeeCurrency},
+	} {
+		places := c.CryptoPrecision
+		if c.isFiat(*field.currency) {
+			places = c.FiatPrecision
+		}
+		if places >= 0 {
+			*field.amount = roundAmount(*field.amount, places)
+		}
+	}
+}
+
+// truncateToDay moves a record's Date to midnight of the same day, and
+// forgets its instant so it sorts by that Date. Dates that were passed
+// through unparsed are left alone.
+func truncateToDay(r *KoinlyRecord) {
+	t, err := time.Parse(koinlyTimeLayout, r.Date)
+	if err != nil {
+		return
+	}
+	r.Date = t.Truncate(24 * time.Hour).Format(koinlyTimeLayout)
+	r.at = time.Time{}
+}
+
+// descriptionVars are the values a description template can refer to.
+type descriptionVars struct {
+	tradeID, asset, side string
+}
+
+// rowVars are the template values of a record converted from one row.
+func rowVars(k33 K33Record) descriptionVars {
+	return descriptionVars{tradeID: k33.TradeID, asset: k33.Asset, side: k33.Side}
+}
+
+// tradeVars are the template values of a trade: asset is its crypto leg
+// (the received one when both or neither are fiat) and side is "Buy" when
+// that asset is received, "Sell" when it is sent.
+func (c *Converter) tradeVars(tradeID, sent, received string) descriptionVars {
+	if c.isFiat(received) && !c.isFiat(sent) {
+		return descriptionVars{tradeID: tradeID, asset: sent, side: "Sell"}
+	}
+	return descriptionVars{tradeID: tradeID, asset: received, side: "Buy"}
+}
+
+// describe returns the Description of a record of kind: its template in
+// c.Descriptions with {tradeID}, {asset}, {side} and {class} ("Fiat" or
+// "Crypto", by asset) filled in, or def when kind has no template.
+func (c *Converter) describe(kind, def string, vars descriptionVars) string {
+	template, ok := c.Descriptions[kind]
+	if !ok {
+		return def
+	}
+	return strings.NewReplacer(
+		"{tradeID}", vars.tradeID,
+		"{asset}", vars.asset,
+		"{side}", vars.side,
+		"{class}", c.assetClass(vars.asset),
+	).Replace(template)
+}
+
+// truncateDescription cuts a description to the limit for its record type.
+func (c *Converter) truncateDescription(r *KoinlyRecord) {
+	limit, ok := c.MaxDescriptionByType[r.kind]
+	if !ok {
+		limit = c.MaxDescription
+	}
+	if limit <= 0 || utf8.RuneCountInString(r.Description) <= limit {
+		return
+	}
+	r.Description = string([]rune(r.Description)[:limit])
+}
+
+// appendLines adds the record's input line numbers to its Description.
+// It runs after finalize's truncation so the reference is never cut off.
+func appendLines(r *KoinlyRecord) {
+	if len(r.lines) == 0 {
+		return
+	}
+	refs := make([]string, len(r.lines))
+	for i, line := range r.lines {
+		refs[i] = strconv.Itoa(line)
+	}
+	label := "line"
+	if len(refs) > 1 {
+		label = "lines"
+	}
+	r.Description = fmt.Sprintf("%s [%s %s]", r.Description, label, strings.Join(refs, ", "))
+}
+
+// applyMinFee clears a fee below the configured minimum for its currency,
+// including the currency, so no orphaned fee currency is left behind.
+func (c *Converter) applyMinFee(r *KoinlyRecord) {
+	if len(c.MinFee) == 0 || r.FeeAmount == "" {
+		return
+	}
+	min, ok := c.MinFee[r.FeeCurrency]
+	if !ok {
+		min, ok = c.MinFee[""]
+	}
+	if !ok {
+		return
+	}
+	fee, err := parseAmount(r.FeeAmount)
+	if err != nil || fee.Cmp(min) >= 0 {
+		return
+	}
+	r.FeeAmount, r.FeeCurrency = "", ""
+	c.droppedFees++
+}
+
+// netFee folds a fee paid in the received currency into the received
+// amount. Fees in another currency, or that cannot be parsed, are kept,
+// as are fees that would leave nothing received, with a warning.
+func (c *Converter) netFee(r *KoinlyRecord) {
+	if r.FeeAmount == "" || r.ReceivedAmount == "" || r.FeeCurrency != r.ReceivedCurrency {
+		return
+	}
+	fee, err := parseAmount(r.FeeAmount)
+	if err != nil {
+		return
+	}
+	received, err := parseAmount(r.ReceivedAmount)
+	if err != nil {
+		return
+	}
+	net := new(big.Rat).Sub(received, fee)
+	if net.Sign() <= 0 {
+		c.warnf("Keeping fee %s %s separate: it is not less than the received %s %s",
+			r.FeeAmount, r.FeeCurrency, r.ReceivedAmount, r.ReceivedCurrency)
+		return
+	}
+	r.ReceivedAmount = formatAmount(net)
+	r.FeeAmount, r.FeeCurrency = "", ""
+}
+
+// ParseMinFee parses a minimum fee spec: either a bare amount applying to
+// every currency, or CURRENCY:AMOUNT for a single currency.
+func ParseMinFee(spec string) (string, *big.Rat, error) {
+	currency, amount, found := strings.Cut(spec, ":")
+	if !found {
+		currency, amount = "", spec
+	}
+	min, err := parseAmount(amount)
+	if err != nil {
+		return "", nil, fmt.Errorf("min fee %q: %w", spec, err)
+	}
+	return strings.ToUpper(strings.TrimSpace(currency)), min, nil
+}
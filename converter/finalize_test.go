@@ -0,0 +1,241 @@
+package converter
+
+import (
+	"bytes"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMinFeeDropsDust(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,0.00000001,BTC
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45,,
+Trade,2,Sell,-0.25,Filled,BTC,2023/01/16 10:30:45,0.001,BTC
+Trade,2,Buy,500,Filled,USD,2023/01/16 10:30:45,,`
+
+	conv := New()
+	conv.MinFee = map[string]*big.Rat{"BTC": big.NewRat(1, 100000)}
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].FeeAmount != "" || records[0].FeeCurrency != "" {
+		t.Errorf("Dust fee not dropped: %s %s", records[0].FeeAmount, records[0].FeeCurrency)
+	}
+	if records[1].FeeAmount != "0.001" || records[1].FeeCurrency != "BTC" {
+		t.Errorf("Normal fee = %s %s, want 0.001 BTC", records[1].FeeAmount, records[1].FeeCurrency)
+	}
+	if conv.droppedFees != 1 {
+		t.Errorf("droppedFees = %d, want 1", conv.droppedFees)
+	}
+}
+
+func TestNetFeeFromReceivedLeg(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,1,Sell,-1000,Filled,USD,2023/01/15 10:30:45,,
+Trade,1,Buy,0.5,Filled,BTC,2023/01/15 10:30:45,0.001,BTC
+Trade,2,Sell,-0.25,Filled,BTC,2023/01/16 10:30:45,2,USD
+Trade,2,Buy,500,Filled,ETH,2023/01/16 10:30:45,,`
+
+	conv := New()
+	conv.NetFee = true
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if r := records[0]; r.ReceivedAmount != "0.499" || r.FeeAmount != "" || r.FeeCurrency != "" {
+		t.Errorf("Netted trade = received %s, fee %s %s; want 0.499 and no fee", r.ReceivedAmount, r.FeeAmount, r.FeeCurrency)
+	}
+	if r := records[1]; r.ReceivedAmount != "500" || r.FeeAmount != "2" || r.FeeCurrency != "USD" {
+		t.Errorf("Other-currency fee changed: received %s, fee %s %s", r.ReceivedAmount, r.FeeAmount, r.FeeCurrency)
+	}
+}
+
+func TestNetFeeNotBelowZero(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,1,Sell,-1000,Filled,USD,2023/01/15 10:30:45,,
+Trade,1,Buy,0.001,Filled,BTC,2023/01/15 10:30:45,0.002,BTC`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conv := New()
+	conv.NetFee = true
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	if r := records[0]; r.ReceivedAmount != "0.001" || r.FeeAmount != "0.002" || r.FeeCurrency != "BTC" {
+		t.Errorf("trade = received %s, fee %s %s; want 0.001 with the 0.002 BTC fee kept", r.ReceivedAmount, r.FeeAmount, r.FeeCurrency)
+	}
+	if !strings.Contains(logs.String(), "Keeping fee 0.002 BTC separate") {
+		t.Errorf("want a warning about the kept fee, got logs:\n%s", logs.String())
+	}
+}
+
+func TestRoundAmounts(t *testing.T) {
+	record := KoinlyRecord{
+		Date:             "2023-01-15 10:30:45",
+		SentAmount:       "20999999.123456785", // beyond float64's digits
+		SentCurrency:     "BTC",
+		ReceivedAmount:   "1234.565",
+		ReceivedCurrency: "USD",
+		FeeAmount:        "0.00000001",
+		FeeCurrency:      "ETH",
+	}
+
+	// Off by default
+	if got := New().finalize([]KoinlyRecord{record})[0]; got.SentAmount != record.SentAmount || got.ReceivedAmount != record.ReceivedAmount {
+		t.Errorf("Amounts rounded without RoundAmounts: %+v", got)
+	}
+
+	conv := New()
+	conv.RoundAmounts = true
+	got := conv.finalize([]KoinlyRecord{record})[0]
+	if got.SentAmount != "20999999.12345679" {
+		t.Errorf("BTC sent = %s, want 20999999.12345679", got.SentAmount)
+	}
+	if got.ReceivedAmount != "1234.57" {
+		t.Errorf("USD received = %s, want 1234.57", got.ReceivedAmount)
+	}
+	if got.FeeAmount != "0.00000001" {
+		t.Errorf("ETH fee = %s, want 0.00000001", got.FeeAmount)
+	}
+
+	conv.CryptoPrecision = 4
+	if got := conv.finalize([]KoinlyRecord{record})[0]; got.SentAmount != "20999999.1235" || got.FeeAmount != "0" {
+		t.Errorf("With 4 crypto decimals sent = %s, fee = %s, want 20999999.1235 and 0", got.SentAmount, got.FeeAmount)
+	}
+}
+
+func TestParseMinFee(t *testing.T) {
+	currency, min, err := ParseMinFee("btc:0.0001")
+	if err != nil || currency != "BTC" || min.Cmp(big.NewRat(1, 10000)) != 0 {
+		t.Errorf("ParseMinFee(btc:0.0001) = %q, %v, %v", currency, min, err)
+	}
+	currency, _, err = ParseMinFee("0.01")
+	if err != nil || currency != "" {
+		t.Errorf("ParseMinFee(0.01) = %q, %v", currency, err)
+	}
+	if _, _, err := ParseMinFee("BTC:abc"); err == nil {
+		t.Error("Expected error for invalid min fee")
+	}
+}
+
+func TestDailyTruncatesToMidnight(t *testing.T) {
+	conv := New()
+	conv.Daily = true
+
+	records, err := conv.parseRecords(strings.NewReader(testCSVInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+
+	expected := []string{"2023-01-16 00:00:00", "2023-01-15 00:00:00"}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(records))
+	}
+	for i, r := range records {
+		if r.Date != expected[i] {
+			t.Errorf("Record %d Date = %s, want %s", i, r.Date, expected[i])
+		}
+	}
+}
+
+func TestMaxDescriptionPerType(t *testing.T) {
+	conv := New()
+	conv.MaxDescription = 8
+	conv.MaxDescriptionByType = map[string]int{"trade": 20}
+
+	records, err := conv.parseRecords(strings.NewReader(testCSVInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+
+	if records[0].Description != "Fiat Wit" {
+		t.Errorf("Withdrawal description = %q, want %q", records[0].Description, "Fiat Wit")
+	}
+	if records[1].Description != "Trade (K33) - 100000" {
+		t.Errorf("Trade description = %q, want %q", records[1].Description, "Trade (K33) - 100000")
+	}
+}
+
+func TestDescLineReferences(t *testing.T) {
+	input := `Exported by K33
+Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),InternalReportID
+Deposit Complete,,,100,,USD,2023/01/14 10:30:45,
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45,
+Withdrawal Complete,,,-50,,USD,2023/01/15 11:30:45,77
+Withdrawal Fee,,,-1,,USD,2023/01/15 11:30:45,77`
+
+	conv := New()
+	conv.DescLine = true
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d: %+v", len(records), records)
+	}
+
+	expected := []string{
+		"Fiat Deposit (K33) [line 3]",
+		"Trade (K33) - 1 [lines 4, 5]",
+		"Fiat Withdrawal (K33) [lines 6, 7]",
+	}
+	for i, want := range expected {
+		if records[i].Description != want {
+			t.Errorf("Description %d = %q, want %q", i, records[i].Description, want)
+		}
+	}
+}
+
+func TestDescriptionTemplates(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,1000,,USD,2023/01/15 10:30:45
+Trade,42,Sell,-0.05,Filled,BTC,2023/01/15 10:31:45
+Trade,42,Buy,1000,Filled,USD,2023/01/15 10:31:45
+Withdrawal Complete,,,-0.2,,BTC,2023/01/15 10:32:45`
+
+	conv := New()
+	conv.Descriptions = map[string]string{
+		"trade":   "{side} {asset} #{tradeID}",
+		"deposit": "K33 {class} in: {asset}",
+	}
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	want := []string{
+		"K33 Fiat in: USD",
+		"Sell BTC #42",
+		"Crypto Withdrawal (K33)", // no template, built-in kept
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, w := range want {
+		if records[i].Description != w {
+			t.Errorf("record %d description = %q, want %q", i, records[i].Description, w)
+		}
+	}
+}
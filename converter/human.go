@@ -0,0 +1,41 @@
+package converter
+
+// humanHeader is the header of the HumanOut CSV.
+var humanHeader = []string{"Date", "Sent", "Received", "Fee", "Net Worth", "Label", "Description"}
+
+// displaySymbols are the symbols amounts are rendered with in HumanOut;
+// other currencies are written after the amount.
+var displaySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// humanRow renders r for HumanOut, joining each amount with its currency.
+func humanRow(r KoinlyRecord) []string {
+	return []string{
+		r.Date,
+		humanAmount(r.SentAmount, r.SentCurrency),
+		humanAmount(r.ReceivedAmount, r.ReceivedCurrency),
+		humanAmount(r.FeeAmount, r.FeeCurrency),
+		humanAmount(r.NetWorthAmount, r.NetWorthCurrency),
+		r.Label,
+		r.Description,
+	}
+}
+
+// humanAmount renders amount in currency as "$1000.50", or "0.5 BTC" for
+// currencies without a display symbol. An empty amount stays empty.
+func humanAmount(amount, currency string) string {
+	if amount == "" {
+		return ""
+	}
+	if symbol, ok := displaySymbols[currency]; ok {
+		return symbol + amount
+	}
+	if currency == "" {
+		return amount
+	}
+	return amount + " " + currency
+}
@@ -0,0 +1,33 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHumanOut(t *testing.T) {
+	human := &strings.Builder{}
+	conv := New()
+	conv.HumanOut = human
+
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(human.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header + 2 rows, got %d lines: %q", len(lines), human.String())
+	}
+	if want := "2023-01-15 10:30:45,0.5 BTC,$1000,,,,Trade (K33) - 1000000012345"; lines[2] != want {
+		t.Errorf("Trade row = %q, want %q", lines[2], want)
+	}
+	if !strings.Contains(lines[1], ",$500,") {
+		t.Errorf("USD withdrawal not rendered with $: %q", lines[1])
+	}
+
+	// The import file itself is unchanged
+	if strings.Contains(output.String(), "$") {
+		t.Errorf("Symbols leaked into the Koinly output: %q", output.String())
+	}
+}
@@ -0,0 +1,176 @@
+package converter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// headerScanLines is how many lines findHeader inspects when looking for
+// the K33 header below leading metadata lines.
+const headerScanLines = 10
+
+// findHeader skips c.SkipLines lines and then returns a reader positioned
+// at the first line (within headerScanLines) that looks like a K33 header.
+// If no such line is found the scanned lines are kept, so header
+// validation reports the problem against the original input.
+//
+// When offset is past the header, the returned reader yields the header
+// followed by the first record starting at or after that offset.
+func (c *Converter) findHeader(in io.Reader, offset int64) (io.Reader, error) {
+	br := bufio.NewReader(in)
+	var consumed int64
+
+	c.linesBeforeHeader, c.linesSought = 0, 0
+	for i := 0; i < c.SkipLines; i++ {
+		line, err := br.ReadString('\n')
+		consumed += int64(len(line))
+		c.linesBeforeHeader++
+		if err != nil {
+			if err == io.EOF {
+				return br, nil
+			}
+			return nil, fmt.Errorf("skipping line %d: %w", i+1, err)
+		}
+	}
+
+	var scanned []string
+	for len(scanned) < headerScanLines {
+		line, err := br.ReadString('\n')
+		consumed += int64(len(line))
+		if line != "" {
+			if c.isHeaderLine(line) {
+				c.linesBeforeHeader += len(scanned)
+				if c.linesSought, err = seekRecord(br, offset-consumed); err != nil {
+					return nil, err
+				}
+				return io.MultiReader(strings.NewReader(line), br), nil
+			}
+			scanned = append(scanned, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+	}
+
+	return io.MultiReader(strings.NewReader(strings.Join(scanned, "")), br), nil
+}
+
+// seekRecord discards skip bytes from br and then the rest of any
+// partially skipped line, leaving br at the next record boundary, and
+// returns how many lines it discarded. Records with quoted embedded
+// newlines are not detected as a single record.
+func seekRecord(br *bufio.Reader, skip int64) (int, error) {
+	lines := 0
+	var last byte = '\n'
+	for ; skip > 0; skip-- {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, fmt.Errorf("seeking to offset: %w", err)
+		}
+		if b == '\n' {
+			lines++
+		}
+		last = b
+	}
+	if last == '\n' {
+		return lines, nil
+	}
+
+	if _, err := br.ReadString('\n'); err != nil && err != io.EOF {
+		return lines, fmt.Errorf("seeking to offset: %w", err)
+	}
+	return lines + 1, nil
+}
+
+// inputLine converts a line number of the CSV findHeader returned to the
+// line number in the original input.
+func (c *Converter) inputLine(csvLine int) int {
+	line := csvLine + c.linesBeforeHeader
+	if csvLine > 1 {
+		line += c.linesSought
+	}
+	return line
+}
+
+// trimCells returns a copy of row with each cell cleaned like a column
+// name: surrounding whitespace and any BOM removed.
+func trimCells(row []string) []string {
+	trimmed := make([]string, len(row))
+	for i, cell := range row {
+		trimmed[i] = cleanColumn(cell)
+	}
+	return trimmed
+}
+
+// isHeaderLine reports whether a raw CSV line holds the required K33
+// columns once mapped through c.Columns.
+func (c *Converter) isHeaderLine(line string) bool {
+	fields, err := c.newReader(strings.NewReader(line)).Read()
+	return err == nil && c.validateHeader(c.mapHeader(fields)) == nil
+}
+
+// ParseDelimiter parses a CSV field delimiter flag value: a single
+// character, or `\t` for tab. A bare "t" is rejected as a likely
+// mistyped tab.
+func ParseDelimiter(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	if s == "t" {
+		return 0, errors.New(`delimiter "t": use \t for tab`)
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError {
+		return 0, fmt.Errorf("delimiter %q: want a single character", s)
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("delimiter %q cannot be used in CSV", s)
+	}
+	return r, nil
+}
+
+// rawRow returns k33's original row laid out in the columns of c.header,
+// matched by column name, so rows from an input or pending file with
+// another column order line up with the reports' header. Columns its
+// input lacked are left empty.
+func (c *Converter) rawRow(k33 *K33Record) []string {
+	target := c.mapHeader(c.header)
+	row := make([]string, len(target))
+	if slices.Equal(target, k33.columns) || k33.columns == nil {
+		copy(row, k33.raw)
+		return row
+	}
+	index := make(map[string]int, len(k33.columns))
+	for i, col := range k33.columns {
+		if _, ok := index[col]; !ok {
+			index[col] = i
+		}
+	}
+	for i, col := range target {
+		if j, ok := index[col]; ok && j < len(k33.raw) {
+			row[i] = k33.raw[j]
+		}
+	}
+	return row
+}
+
+// newReader returns a CSV reader for input, splitting on c.InDelimiter.
+func (c *Converter) newReader(in io.Reader) *csv.Reader {
+	reader := csv.NewReader(in)
+	if c.InDelimiter != 0 {
+		reader.Comma = c.InDelimiter
+	}
+	return reader
+}
@@ -0,0 +1,143 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+const metadataCSVInput = `Account: 12345
+Exported: 2023/02/01 08:00:00
+Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,100,USD,2023/01/15 10:30:45
+Withdrawal Complete,-50,USD,2023/01/16 10:30:45`
+
+func TestHeaderAfterMetadataLines(t *testing.T) {
+	records, err := New().parseRecords(strings.NewReader(metadataCSVInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].ReceivedAmount != "100" || records[1].SentAmount != "50" {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+}
+
+func TestSkipLines(t *testing.T) {
+	conv := New()
+	conv.SkipLines = 2
+
+	records, err := conv.parseRecords(strings.NewReader(metadataCSVInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected 2 records, got %d", len(records))
+	}
+}
+
+func TestStartOffsetResumesAtNextRecord(t *testing.T) {
+	input := "Type/Status,Amount,Asset,Timestamp (UTC)\n" +
+		"Deposit Complete,100,USD,2023/01/15 10:30:45\n" +
+		"Deposit Complete,200,USD,2023/01/16 10:30:45\n" +
+		"Deposit Complete,300,USD,2023/01/17 10:30:45\n"
+	second := strings.Index(input, "Deposit Complete,200")
+
+	tests := []struct {
+		name     string
+		offset   int64
+		expected []string
+	}{
+		{"start", 0, []string{"100", "200", "300"}},
+		{"record boundary", int64(second), []string{"200", "300"}},
+		{"mid record", int64(second + 5), []string{"300"}},
+		{"past end", int64(len(input) + 10), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conv := New()
+			conv.StartOffset = test.offset
+			records, err := conv.parseRecords(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("parseRecords failed: %v", err)
+			}
+			if len(records) != len(test.expected) {
+				t.Fatalf("Expected %d records, got %d", len(test.expected), len(records))
+			}
+			for i, r := range records {
+				if r.ReceivedAmount != test.expected[i] {
+					t.Errorf("Record %d = %s, want %s", i, r.ReceivedAmount, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNoTrimKeepsCellWhitespace(t *testing.T) {
+	input := "Type/Status,Amount,Asset,Timestamp (UTC),DepositTxhash\n" +
+		"Deposit Complete,1, BTC ,2023/01/15 10:30:45,\"  bc1q  abc \"\n"
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ReceivedCurrency != "BTC" || records[0].TxHash != "bc1q  abc" {
+		t.Errorf("Cells not trimmed by default: %+v", records)
+	}
+
+	conv := New()
+	conv.NoTrim = true
+	records, err = conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ReceivedCurrency != " BTC " || records[0].TxHash != "  bc1q  abc " {
+		t.Errorf("Whitespace not preserved with NoTrim: %+v", records)
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		input string
+		want  rune
+		ok    bool
+	}{
+		{";", ';', true},
+		{",", ',', true},
+		{`\t`, '\t', true},
+		{"|", '|', true},
+		{"t", 0, false},
+		{"", 0, false},
+		{";;", 0, false},
+		{`"`, 0, false},
+	}
+	for _, test := range tests {
+		got, err := ParseDelimiter(test.input)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v; want %q, ok=%v", test.input, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	input := "Export for account 1\n" +
+		"Type/Status;TradeID;Side;Amount;Trade Status;Asset;Timestamp (UTC)\n" +
+		"Deposit Complete;;;1000.50;;EUR;2023/01/15 10:30:45\n"
+
+	conv := New()
+	conv.InDelimiter = ';'
+	conv.OutDelimiter = '\t'
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 || lines[0] != strings.ReplaceAll(KoinlyHeader, ",", "\t") {
+		t.Fatalf("want a tab-separated header and row, got %q", output.String())
+	}
+	if !strings.HasPrefix(lines[1], "2023-01-15 10:30:45\t\t\t1000.5\tEUR\t") {
+		t.Errorf("row = %q, want the semicolon-separated deposit", lines[1])
+	}
+}
@@ -0,0 +1,39 @@
+package converter
+
+import "log"
+
+// LogLevel controls which diagnostics the converter logs. Errors are
+// returned rather than logged, so they are never suppressed.
+type LogLevel int
+
+const (
+	// LogQuiet logs nothing.
+	LogQuiet LogLevel = -1
+	// LogWarnings logs warnings about the data, the default.
+	LogWarnings LogLevel = 0
+	// LogVerbose also logs progress and informational notes.
+	LogVerbose LogLevel = 1
+)
+
+// warnf logs a warning about the input unless c.LogLevel is LogQuiet,
+// counting it either way.
+func (c *Converter) warnf(format string, args ...any) {
+	c.warnings++
+	if c.LogLevel >= LogWarnings {
+		log.Printf("Warning: "+format, args...)
+	}
+}
+
+// Warnings returns how many warnings the last conversion raised, whether
+// or not they were logged, so callers can treat a conversion with
+// warnings as failed.
+func (c *Converter) Warnings() int {
+	return c.warnings
+}
+
+// infof logs an informational note under LogVerbose.
+func (c *Converter) infof(format string, args ...any) {
+	if c.LogLevel >= LogVerbose {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	// Metadata above the header is an info note; the unpaired trade a
+	// warning
+	input := `Account: 12345
+Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Buy,0.05,Filled,BTC,2023/01/15 10:30:45`
+
+	tests := []struct {
+		level       LogLevel
+		warn, infos bool
+	}{
+		{LogQuiet, false, false},
+		{LogWarnings, true, false},
+		{LogVerbose, true, true},
+	}
+	for _, test := range tests {
+		var logs bytes.Buffer
+		log.SetOutput(&logs)
+		conv := New()
+		conv.LogLevel = test.level
+		_, err := conv.parseRecords(strings.NewReader(input))
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			t.Fatalf("level %d: parseRecords failed: %v", test.level, err)
+		}
+
+		if got := strings.Contains(logs.String(), "Warning: 1 unpaired trades"); got != test.warn {
+			t.Errorf("level %d: logged warning = %v, want %v:\n%s", test.level, got, test.warn, logs.String())
+		}
+		if got := strings.Contains(logs.String(), "Found the header below 1 leading lines"); got != test.infos {
+			t.Errorf("level %d: logged info = %v, want %v:\n%s", test.level, got, test.infos, logs.String())
+		}
+		// Warnings are counted even when not logged: the unpaired trade
+		// and the input producing no output
+		if got := conv.Warnings(); got != 2 {
+			t.Errorf("level %d: Warnings = %d, want 2", test.level, got)
+		}
+	}
+}
+
+func TestWarningsResetPerConversion(t *testing.T) {
+	conv := New()
+	conv.LogLevel = LogQuiet
+	if _, err := conv.parseRecords(strings.NewReader("Type/Status,Amount,Asset,Timestamp (UTC)\nDeposit Complete,n/a,USD,2023/01/15 10:30:45\nDeposit Complete,100,USD,2023/01/15 10:31:45")); err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if got := conv.Warnings(); got != 1 {
+		t.Errorf("Warnings = %d, want 1 for the invalid amount", got)
+	}
+	if _, err := conv.parseRecords(strings.NewReader("Type/Status,Amount,Asset,Timestamp (UTC)\nDeposit Complete,100,USD,2023/01/15 10:30:45")); err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if got := conv.Warnings(); got != 0 {
+		t.Errorf("Warnings = %d after a clean conversion, want 0", got)
+	}
+}
@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Manifest describes a written output file so downstream systems can
+// verify it.
+type Manifest struct {
+	File       string            `json:"file"`
+	SHA256     string            `json:"sha256"`
+	Rows       int               `json:"rows"`
+	FirstDate  string            `json:"first_date,omitempty"`
+	LastDate   string            `json:"last_date,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// Manifest builds the manifest of the output file at path, as written by
+// the last Process call, recording params as the conversion parameters.
+// Call it once the output file is closed.
+func (c *Converter) Manifest(path string, params map[string]string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening output for manifest: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("hashing output: %w", err)
+	}
+	return &Manifest{
+		File:       filepath.Base(path),
+		SHA256:     hex.EncodeToString(h.Sum(nil)),
+		Rows:       c.written.rows,
+		FirstDate:  c.written.first,
+		LastDate:   c.written.last,
+		Parameters: params,
+	}, nil
+}
+
+// Write encodes m as indented JSON.
+func (m *Manifest) Write(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// outputSummary is what Process wrote: the row count and date range.
+type outputSummary struct {
+	rows        int
+	first, last string
+}
+
+// add counts r into the summary.
+func (s *outputSummary) add(r KoinlyRecord) {
+	s.rows++
+	if s.first == "" || r.Date < s.first {
+		s.first = r.Date
+	}
+	if r.Date > s.last {
+		s.last = r.Date
+	}
+}
@@ -0,0 +1,58 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "koinly.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := New()
+	if err := conv.Process(strings.NewReader(testCSVInput), f); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := conv.Manifest(path, map[string]string{"daily": "false"})
+	if err != nil {
+		t.Fatalf("Manifest failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if m.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", m.SHA256, sum)
+	}
+	if m.File != "koinly.csv" || m.Rows != 2 {
+		t.Errorf("Manifest file/rows = %s/%d, want koinly.csv/2", m.File, m.Rows)
+	}
+	if m.FirstDate != "2023-01-15 10:30:45" || m.LastDate != "2023-01-16 14:20:30" {
+		t.Errorf("Date range = %s..%s", m.FirstDate, m.LastDate)
+	}
+
+	var out strings.Builder
+	if err := m.Write(&out); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var decoded Manifest
+	if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+	if decoded.SHA256 != m.SHA256 || decoded.Parameters["daily"] != "false" {
+		t.Errorf("Decoded manifest = %+v", decoded)
+	}
+}
@@ -0,0 +1,84 @@
+package converter
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+// mergeMaxIDGap is how far apart two numeric trade ids may be for their
+// orphan legs to be merged under MergeWindow.
+const mergeMaxIDGap = 100
+
+// mergeOrphans pairs lone buy legs with lone sell legs left in c.trades
+// whose ids nearly match and whose timestamps are within c.MergeWindow,
+// choosing the closest sell leg in time for each buy leg.
+func (c *Converter) mergeOrphans() []KoinlyRecord {
+	ids := make([]string, 0, len(c.trades))
+	for id := range c.trades {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var buys, sells []*TradePair
+	for _, id := range ids {
+		trade := c.trades[id]
+		switch {
+		case len(trade.BuyLegs) > 0 && len(trade.SellLegs) == 0:
+			buys = append(buys, trade)
+		case len(trade.SellLegs) > 0 && len(trade.BuyLegs) == 0:
+			sells = append(sells, trade)
+		}
+	}
+
+	var records []KoinlyRecord
+	merged := make(map[*TradePair]bool)
+	for _, buy := range buys {
+		buyTime, err := parseTimestamp(buy.BuyLegs[0].Timestamp)
+		if err != nil {
+			continue
+		}
+
+		var best *TradePair
+		var bestGap time.Duration
+		for _, sell := range sells {
+			if merged[sell] || !idsNearlyMatch(buy.TradeID, sell.TradeID) {
+				continue
+			}
+			sellTime, err := parseTimestamp(sell.SellLegs[0].Timestamp)
+			if err != nil {
+				continue
+			}
+			gap := buyTime.Sub(sellTime).Abs()
+			if gap <= c.MergeWindow && (best == nil || gap < bestGap) {
+				best, bestGap = sell, gap
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		c.warnf("Merged orphan legs of trades %s and %s (%s apart)", buy.TradeID, best.TradeID, bestGap)
+		merged[best] = true
+		delete(c.trades, buy.TradeID)
+		delete(c.trades, best.TradeID)
+		buy.SellLegs = best.SellLegs
+		buy.FeeLegs = append(buy.FeeLegs, best.FeeLegs...)
+		records = append(records, c.completeTrade(buy)...)
+	}
+	return records
+}
+
+// idsNearlyMatch reports whether two numeric trade ids are within
+// mergeMaxIDGap of each other.
+func idsNearlyMatch(a, b string) bool {
+	x, ok := new(big.Int).SetString(a, 10)
+	if !ok {
+		return false
+	}
+	y, ok := new(big.Int).SetString(b, 10)
+	if !ok {
+		return false
+	}
+	return x.Sub(x, y).CmpAbs(big.NewInt(mergeMaxIDGap)) <= 0
+}
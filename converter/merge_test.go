@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const orphanLegsInput = `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1000,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1001,Buy,1000,Filled,USD,2023/01/15 10:30:47
+Trade,5000,Buy,200,Filled,USD,2023/01/15 10:30:46`
+
+func TestMergeWindowPairsOrphanLegs(t *testing.T) {
+	conv := New()
+	conv.MergeWindow = 5 * time.Second
+
+	records, err := conv.parseRecords(strings.NewReader(orphanLegsInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 merged trade, got %d", len(records))
+	}
+	r := records[0]
+	if r.SentAmount != "0.5" || r.SentCurrency != "BTC" || r.ReceivedAmount != "1000" || r.ReceivedCurrency != "USD" {
+		t.Errorf("Merged trade = %+v", r)
+	}
+	// Trade 5000 is close in time but its id is too far away to merge
+	if _, pending := conv.trades["5000"]; !pending {
+		t.Error("Expected trade 5000 to stay unpaired")
+	}
+}
+
+func TestMergeWindowRespectsGap(t *testing.T) {
+	conv := New()
+	conv.MergeWindow = time.Second
+
+	records, err := conv.parseRecords(strings.NewReader(orphanLegsInput))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected no merge for legs 2s apart under a 1s window, got %d records", len(records))
+	}
+}
+
+func TestIDsNearlyMatch(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"1000", "1001", true},
+		{"1000", "1100", true},
+		{"1000", "1101", false},
+		{"abc", "abd", false},
+	}
+
+	for _, test := range tests {
+		if result := idsNearlyMatch(test.a, test.b); result != test.expected {
+			t.Errorf("idsNearlyMatch(%s, %s) = %v, want %v", test.a, test.b, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+)
+
+// OutputOrder is the order records are written in.
+type OutputOrder string
+
+const (
+	// OrderInput keeps records in the order they were converted.
+	OrderInput OutputOrder = "input"
+	// OrderDate sorts records by date, keeping input order within a date.
+	OrderDate OutputOrder = "date"
+	// OrderType groups deposits, then trades, then internal transfers,
+	// then withdrawals.
+	OrderType OutputOrder = "type"
+)
+
+// movementRank orders movements for OrderType.
+var movementRank = map[string]int{"Deposit": 0, "Trade": 1, "Transfer": 2, "Withdrawal": 3}
+
+// sortRecords reorders records in place per c.OutputOrder. Both sorts are
+// stable, so input order breaks ties.
+func (c *Converter) sortRecords(records []KoinlyRecord) {
+	if cmp := c.recordOrder(); cmp != nil {
+		slices.SortStableFunc(records, cmp)
+	}
+}
+
+// recordOrder returns the comparison c.OutputOrder sorts by, or nil when
+// records keep input order. Reverse sorts dates newest first, implying
+// OrderDate on its own and ordering each group under OrderType.
+func (c *Converter) recordOrder() func(a, b KoinlyRecord) int {
+	// Records compare by the instant their Date was formatted from, so
+	// the hour repeated when DST ends sorts right; koinlyTimeLayout sorts
+	// lexically in time order for records without one
+	byDate := func(a, b KoinlyRecord) int {
+		if c.Reverse {
+			a, b = b, a
+		}
+		if !a.at.IsZero() && !b.at.IsZero() {
+			return a.at.Compare(b.at)
+		}
+		return strings.Compare(a.Date, b.Date)
+	}
+
+	switch c.OutputOrder {
+	case OrderDate:
+		return byDate
+	case OrderType:
+		return func(a, b KoinlyRecord) int {
+			if rank := movementRank[movement(a)] - movementRank[movement(b)]; rank != 0 || !c.Reverse {
+				return rank
+			}
+			return byDate(a, b)
+		}
+	}
+	if c.Reverse {
+		return byDate
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputOrder(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Withdrawal Complete,,,-100,,USD,2023/01/13 10:00:00
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:00:00
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:00:00
+Deposit Complete,,,2,,ETH,2023/01/14 10:00:00
+Withdrawal Complete,,,-1,,ETH,2023/01/12 10:00:00`
+
+	tests := []struct {
+		order OutputOrder
+		want  []string
+	}{
+		{OrderInput, []string{"2023-01-13 10:00:00", "2023-01-15 10:00:00", "2023-01-14 10:00:00", "2023-01-12 10:00:00"}},
+		{OrderDate, []string{"2023-01-12 10:00:00", "2023-01-13 10:00:00", "2023-01-14 10:00:00", "2023-01-15 10:00:00"}},
+		{OrderType, []string{"2023-01-14 10:00:00", "2023-01-15 10:00:00", "2023-01-13 10:00:00", "2023-01-12 10:00:00"}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.order), func(t *testing.T) {
+			conv := New()
+			conv.OutputOrder = test.order
+			records, err := conv.parseRecords(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("parseRecords failed: %v", err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.Date)
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("order = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReverseOrder(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,1,BTC,2023/01/13 10:00:00
+Deposit Complete,2,BTC,2023/01/15 10:00:00
+Deposit Complete,3,BTC,2023/01/14 10:00:00`
+
+	conv := New()
+	conv.Reverse = true
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "Date,") {
+		t.Fatalf("Expected the header then 3 rows, got %q", output.String())
+	}
+	for i, want := range []string{"2023-01-15", "2023-01-14", "2023-01-13"} {
+		if !strings.HasPrefix(lines[i+1], want) {
+			t.Errorf("Row %d = %q, want date %s", i+1, lines[i+1], want)
+		}
+	}
+}
+
+func TestDateOrderPlacesLateTrades(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:00:00
+Deposit Complete,,,2,,ETH,2023/01/15 10:00:00
+Deposit Complete,,,3,,ETH,2023/01/15 11:00:00
+Trade,1,Buy,1000,Filled,USD,2023/01/15 12:00:00`
+
+	conv := New()
+	conv.OutputOrder = OrderDate
+	conv.TradeTime = TradeTimeFirst
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.kind+" "+r.Date)
+	}
+	// the trade completes last but is dated by its first leg; same-time
+	// rows keep their input order
+	want := []string{"deposit 2023-01-15 10:00:00", "trade 2023-01-15 10:00:00", "deposit 2023-01-15 11:00:00"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestDateOrderAcrossDSTEnd(t *testing.T) {
+	// 01:15 UTC is 02:15 CET, after 00:45 UTC at 02:45 CEST
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,1,BTC,2023/10/29 01:15:00
+Deposit Complete,2,BTC,2023/10/29 00:45:00`
+
+	for _, maxBuffer := range []int{0, 1} {
+		conv := New()
+		conv.OutputOrder = OrderDate
+		conv.Location = LoadLocation("Europe/Oslo")
+		conv.MaxBuffer = maxBuffer
+		records, err := conv.parseRecords(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseRecords failed: %v", err)
+		}
+		var got []string
+		for _, r := range records {
+			got = append(got, r.ReceivedAmount+" "+r.Date)
+		}
+		want := []string{"2 2023-10-29 02:45:00", "1 2023-10-29 02:15:00"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("MaxBuffer %d: order = %v, want %v", maxBuffer, got, want)
+		}
+	}
+}
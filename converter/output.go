@@ -0,0 +1,183 @@
+package converter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Format is the encoding Process writes records in.
+type Format string
+
+const (
+	// FormatCSV writes a CSV file in the Target layout.
+	FormatCSV Format = "csv"
+	// FormatJSONL writes each KoinlyRecord as one JSON object per line,
+	// omitting empty fields.
+	FormatJSONL Format = "jsonl"
+)
+
+// Target is an output CSV layout.
+type Target string
+
+const (
+	// TargetKoinly writes Koinly Universal CSV.
+	TargetKoinly Target = "koinly"
+	// TargetCoinTracking writes CoinTracking's CSV import format.
+	TargetCoinTracking Target = "cointracking"
+)
+
+// cointrackingHeader is CoinTracking's CSV import header, in column order.
+var cointrackingHeader = []string{
+	"Type", "Buy Amount", "Buy Currency", "Sell Amount", "Sell Currency",
+	"Fee", "Fee Currency", "Exchange", "Trade-Group", "Comment", "Date", "Tx-ID",
+}
+
+// outputHeader returns the header row for the configured target.
+func (c *Converter) outputHeader() []string {
+	header := koinlyHeader
+	if c.Target == TargetCoinTracking {
+		header = cointrackingHeader
+	}
+	if c.tagging() {
+		header = append(slices.Clip(header), "Tag")
+	}
+	if c.WithSeq {
+		header = append([]string{"Seq"}, header...)
+	}
+	return header
+}
+
+// tagging reports whether the optional Tag column is written.
+func (c *Converter) tagging() bool {
+	return c.Tag != "" || len(c.TagsByAsset) > 0
+}
+
+// tagFor picks the tag for a record: an asset rule matching its received
+// currency, then its sent currency, falling back to the constant Tag.
+func (c *Converter) tagFor(r KoinlyRecord) string {
+	for _, currency := range []string{r.ReceivedCurrency, r.SentCurrency} {
+		if tag, ok := c.TagsByAsset[currency]; ok && currency != "" {
+			return tag
+		}
+	}
+	return c.Tag
+}
+
+// movement classifies a record by which of its sides are set: "Trade"
+// when both are, "Deposit" for received only and "Withdrawal" otherwise.
+// A merged internal transfer is a "Transfer", though it has both sides.
+func movement(record KoinlyRecord) string {
+	switch {
+	case record.kind == "transfer":
+		return "Transfer"
+	case record.SentCurrency != "" && record.ReceivedCurrency != "":
+		return "Trade"
+	case record.ReceivedCurrency != "":
+		return "Deposit"
+	}
+	return "Withdrawal"
+}
+
+// cointrackingType returns the CoinTracking type of record: the type
+// matching its Label, "Staking" for staking locks, or else its movement.
+// Adjustments keep their movement, so a balance correction is a deposit or
+// withdrawal rather than income.
+func cointrackingType(record KoinlyRecord) string {
+	switch {
+	case record.Label == "reward":
+		return "Income"
+	case record.Label == "interest":
+		return "Interest Income"
+	case record.Label == "fork":
+		return "Airdrop"
+	case record.Label == "cost":
+		return "Other Fee"
+	case record.kind == "staking":
+		return "Staking"
+	}
+	return movement(record)
+}
+
+// cointrackingRow renders record in cointrackingHeader column order.
+func cointrackingRow(record KoinlyRecord) []string {
+	return []string{
+		cointrackingType(record), record.ReceivedAmount, record.ReceivedCurrency,
+		record.SentAmount, record.SentCurrency,
+		record.FeeAmount, record.FeeCurrency,
+		"K33", "", record.Description, record.Date, record.TxHash,
+	}
+}
+
+// isOutputColumn reports whether col is a column of any output target.
+func isOutputColumn(col string) bool {
+	return slices.Contains(koinlyHeader, col) || slices.Contains(cointrackingHeader, col) || col == "Tag"
+}
+
+// ANSI escape sequences used to colorize dry-run output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiBlue  = "\x1b[34m"
+)
+
+// colorize wraps line in the color for the record's movement: green for
+// deposits, red for withdrawals and blue for trades and transfers.
+func colorize(record KoinlyRecord, line string) string {
+	color := ansiRed
+	switch movement(record) {
+	case "Trade", "Transfer":
+		color = ansiBlue
+	case "Deposit":
+		color = ansiGreen
+	}
+	return color + line + ansiReset
+}
+
+// processJSONL is ProcessAll for FormatJSONL. There is no header, and the
+// CSV-only options (Target, WithSeq, Transforms, ZeroFillAmounts) do not
+// apply.
+func (c *Converter) processJSONL(ins []io.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+
+	var tee *json.Encoder
+	if c.TeeJSON != nil {
+		tee = json.NewEncoder(c.TeeJSON)
+	}
+
+	emit := func(record KoinlyRecord) error {
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("writing record: %w", err)
+		}
+		if tee != nil {
+			if err := tee.Encode(record); err != nil {
+				return fmt.Errorf("writing tee record: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := c.convert(ins, nil, emit); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return c.writeReports()
+}
+
+// newWriter returns a CSV writer for output, separating fields with
+// c.OutDelimiter.
+func (c *Converter) newWriter(out io.Writer) *csv.Writer {
+	writer := csv.NewWriter(out)
+	if c.OutDelimiter != 0 {
+		writer.Comma = c.OutDelimiter
+	}
+	return writer
+}
@@ -0,0 +1,201 @@
+package converter
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCoinTrackingTarget(t *testing.T) {
+	output := &strings.Builder{}
+	conv := New()
+	conv.Target = TargetCoinTracking
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header + 2 rows, got %d lines", len(lines))
+	}
+
+	expectedHeader := "Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID"
+	if lines[0] != expectedHeader {
+		t.Errorf("Header = %q, want %q", lines[0], expectedHeader)
+	}
+
+	expectedTrade := "Trade,1000,USD,0.5,BTC,,,K33,,Trade (K33) - 1000000012345,2023-01-15 10:30:45,"
+	if lines[2] != expectedTrade {
+		t.Errorf("Trade row = %q, want %q", lines[2], expectedTrade)
+	}
+	if !strings.HasPrefix(lines[1], "Withdrawal,,,500,USD,") {
+		t.Errorf("Withdrawal row = %q", lines[1])
+	}
+}
+
+func TestCoinTrackingLabelTypes(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Staking Reward,0.1,ETH,2023/01/15 10:30:45
+Interest Payout,5,USD,2023/01/15 10:30:46
+Fork Complete,1,BCH,2023/01/15 10:30:47
+Staking Deposit,-2,ETH,2023/01/15 10:30:48
+Balance Adjustment,-0.5,USD,2023/01/15 10:30:49
+Balance Adjustment,0.5,USD,2023/01/15 10:30:50`
+
+	output := &strings.Builder{}
+	conv := New()
+	conv.Target = TargetCoinTracking
+	if err := conv.Process(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")[1:]
+	want := []string{"Income", "Interest Income", "Airdrop", "Staking", "Withdrawal", "Deposit"}
+	if len(lines) != len(want) {
+		t.Fatalf("want %d rows, got:\n%s", len(want), output.String())
+	}
+	for i, typ := range want {
+		if !strings.HasPrefix(lines[i], typ+",") {
+			t.Errorf("row %d = %q, want Type %s", i, lines[i], typ)
+		}
+	}
+
+	if got := cointrackingType(KoinlyRecord{SentAmount: "1", SentCurrency: "EUR", Label: "cost", kind: "trade"}); got != "Other Fee" {
+		t.Errorf("cost row type = %s, want Other Fee", got)
+	}
+}
+
+func TestTagColumn(t *testing.T) {
+	conv := New()
+	conv.Tag = "core"
+	conv.TagsByAsset = map[string]string{"BTC": "hodl"}
+
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header + 2 rows, got %d lines", len(lines))
+	}
+	if !strings.HasSuffix(lines[0], ",TxHash,Tag") {
+		t.Errorf("Header missing Tag column: %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], ",core") {
+		t.Errorf("Withdrawal tag should be the constant tag: %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], ",hodl") {
+		t.Errorf("BTC trade tag should come from the asset rule: %q", lines[2])
+	}
+
+	// Without tagging the header is unchanged
+	output.Reset()
+	if err := New().Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if strings.Contains(output.String(), "Tag") {
+		t.Error("Tag column written without tagging enabled")
+	}
+}
+
+func TestWithSeqColumn(t *testing.T) {
+	conv := New()
+	conv.WithSeq = true
+	conv.Tag = "core"
+
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header + 2 rows, got %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "Seq,Date,") || !strings.HasSuffix(lines[0], ",Tag") {
+		t.Errorf("Header = %q, want a leading Seq column", lines[0])
+	}
+	for i, line := range lines[1:] {
+		if want := strconv.Itoa(i+1) + ",2023-"; !strings.HasPrefix(line, want) {
+			t.Errorf("Row %d = %q, want prefix %q", i+1, line, want)
+		}
+	}
+}
+
+func TestDryRunColor(t *testing.T) {
+	plain := &strings.Builder{}
+	if err := New().ProcessDryRun(strings.NewReader(testCSVInput), plain); err != nil {
+		t.Fatalf("ProcessDryRun failed: %v", err)
+	}
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("ANSI codes emitted with color disabled: %q", plain.String())
+	}
+
+	colored := &strings.Builder{}
+	conv := New()
+	conv.Color = true
+	if err := conv.ProcessDryRun(strings.NewReader(testCSVInput), colored); err != nil {
+		t.Fatalf("ProcessDryRun failed: %v", err)
+	}
+	if !strings.Contains(colored.String(), ansiRed+"2023-01-16") || !strings.Contains(colored.String(), ansiBlue+"2023-01-15") {
+		t.Errorf("Expected red withdrawal and blue trade lines, got %q", colored.String())
+	}
+}
+
+func TestJSONLFormat(t *testing.T) {
+	conv := New()
+	conv.Format = FormatJSONL
+
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records and no header, got %d lines: %q", len(lines), output.String())
+	}
+	want := `{"date":"2023-01-15 10:30:45","sent_amount":"0.5","sent_currency":"BTC","received_amount":"1000","received_currency":"USD","description":"Trade (K33) - 1000000012345"}`
+	if lines[1] != want {
+		t.Errorf("Trade line = %s, want %s", lines[1], want)
+	}
+	if strings.Contains(lines[0], `""`) {
+		t.Errorf("Empty fields not omitted: %s", lines[0])
+	}
+}
+
+func TestKoinlyHeaderExact(t *testing.T) {
+	// Spelled out rather than built from KoinlyHeader, so any change to a
+	// column name fails here
+	const want = "Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash"
+	if KoinlyHeader != want {
+		t.Fatalf("KoinlyHeader = %q, want %q", KoinlyHeader, want)
+	}
+
+	output := &strings.Builder{}
+	if err := New().Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	header, _, _ := strings.Cut(output.String(), "\n")
+	if header != want {
+		t.Errorf("Process header = %q, want %q", header, want)
+	}
+	if len(koinlyRow(KoinlyRecord{})) != len(koinlyHeader) {
+		t.Errorf("koinlyRow has %d columns, header has %d", len(koinlyRow(KoinlyRecord{})), len(koinlyHeader))
+	}
+}
+
+func TestBOM(t *testing.T) {
+	conv := New()
+	conv.BOM = true
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(testCSVInput), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if !strings.HasPrefix(output.String(), "\ufeff"+KoinlyHeader+"\n") {
+		t.Errorf("output starts %q, want a BOM then the header", output.String()[:20])
+	}
+	if strings.Count(output.String(), "\ufeff") != 1 {
+		t.Error("want exactly one BOM")
+	}
+}
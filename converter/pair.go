@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// isPairAsset reports whether asset names a trading pair such as
+// "BTC/USD" rather than a single currency.
+func isPairAsset(asset string) bool {
+	base, quote, ok := strings.Cut(asset, "/")
+	return ok && strings.TrimSpace(base) != "" && strings.TrimSpace(quote) != ""
+}
+
+// splitPairTrade expands a single-row trade on a pair asset into its two
+// legs: Amount is in the base currency and Price is the quote currency
+// per unit of base. The side comes from Side, or from the sign of Amount
+// when Side is empty.
+func splitPairTrade(k33 K33Record) (buy, sell *K33Record, err error) {
+	base, quote, _ := strings.Cut(k33.Asset, "/")
+	base, quote = strings.TrimSpace(base), strings.TrimSpace(quote)
+
+	amount, err := parseAmount(k33.Amount)
+	if err != nil {
+		return nil, nil, fmt.Errorf("trade %s on %s has an invalid amount %q", k33.TradeID, k33.Asset, k33.Amount)
+	}
+	price, err := parseAmount(k33.Price)
+	if err != nil || price.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("trade %s on %s has no valid price", k33.TradeID, k33.Asset)
+	}
+
+	side := k33.Side
+	if side == "" {
+		side = "Buy"
+		if amount.Sign() < 0 {
+			side = "Sell"
+		}
+	}
+	amount.Abs(amount)
+	total := new(big.Rat).Mul(amount, price)
+
+	// The row's inline fee and line number stay on the base leg only, so
+	// neither is counted twice
+	baseLeg, quoteLeg := k33, k33
+	baseLeg.Asset, quoteLeg.Asset = base, quote
+	quoteLeg.Fee, quoteLeg.FeeCurrency, quoteLeg.line = "", "", 0
+	switch side {
+	case "Buy":
+		baseLeg.Side, baseLeg.Amount = "Buy", formatAmount(amount)
+		quoteLeg.Side, quoteLeg.Amount = "Sell", "-"+formatAmount(total)
+		return &baseLeg, &quoteLeg, nil
+	case "Sell":
+		baseLeg.Side, baseLeg.Amount = "Sell", "-"+formatAmount(amount)
+		quoteLeg.Side, quoteLeg.Amount = "Buy", formatAmount(total)
+		return &quoteLeg, &baseLeg, nil
+	}
+	return nil, nil, fmt.Errorf("trade %s on %s has an unknown side %q", k33.TradeID, k33.Asset, k33.Side)
+}
@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPairAssetTrade(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Price,Trade Status,Asset,Timestamp (UTC)
+Trade,7,Buy,0.5,20000.10,Filled,BTC/USD,2023/01/15 10:30:45
+Trade,8,,-2,1500,Filled,ETH/EUR,2023/01/16 10:30:45
+Trade,9,Buy,1,,Filled,BTC/USD,2023/01/17 10:30:45`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 trades, got %d: %+v", len(records), records)
+	}
+
+	buy := records[0]
+	if buy.SentAmount != "10000.05" || buy.SentCurrency != "USD" || buy.ReceivedAmount != "0.5" || buy.ReceivedCurrency != "BTC" {
+		t.Errorf("Buy trade = %+v, want 10000.05 USD -> 0.5 BTC", buy)
+	}
+	if buy.Description != "Trade (K33) - 7" {
+		t.Errorf("Description = %q", buy.Description)
+	}
+
+	// No Side: a negative amount sells the base currency
+	sell := records[1]
+	if sell.SentAmount != "2" || sell.SentCurrency != "ETH" || sell.ReceivedAmount != "3000" || sell.ReceivedCurrency != "EUR" {
+		t.Errorf("Sell trade = %+v, want 2 ETH -> 3000 EUR", sell)
+	}
+
+	if rejects := conv.Rejects(); len(rejects) != 1 || !strings.Contains(rejects[0].Reason, "no valid price") {
+		t.Errorf("Rejects = %+v, want the row without a price", rejects)
+	}
+}
+
+func TestPairAssetTradeFee(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Price,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,7,Buy,0.5,20000,Filled,BTC/USD,2023/01/15 10:30:45,5,USD`
+
+	conv := New()
+	conv.DescLine = true
+	var out strings.Builder
+	if err := conv.Process(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want one trade row, got:\n%s", out.String())
+	}
+	if want := "2023-01-15 10:30:45,10000,USD,0.5,BTC,5,USD,,,,Trade (K33) - 7 [line 2],"; !strings.HasPrefix(lines[1], want) {
+		t.Errorf("trade row = %s, want prefix %s", lines[1], want)
+	}
+}
@@ -0,0 +1,90 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+// LoadPending seeds the trade-pairing state with half-trades persisted by
+// an earlier run's PendingOut, so their counterpart legs in this run's
+// input can complete them. The pending file is a K33 CSV with its own
+// header.
+func (c *Converter) LoadPending(in io.Reader) error {
+	// Trades left open by an earlier conversion are not carried over
+	if !c.seeded {
+		c.resetTrades()
+		c.seeded = true
+	}
+	reader := c.newReader(in)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading pending header: %w", err)
+	}
+	header = c.mapHeader(header)
+	if err := c.validateHeader(header); err != nil {
+		return fmt.Errorf("pending file: %w", err)
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			c.carried = append(c.carried, c.settleFilled(nil)...)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading pending record: %w", err)
+		}
+
+		if !c.NoTrim {
+			row = trimCells(row)
+		}
+		k33 := c.parseK33Record(header, row)
+		if k33.TypeStatus != "Trade" && !isTradeFee(k33) {
+			continue
+		}
+		if err := c.normalizeRow(&k33); err != nil {
+			c.warnf("Skipping pending trade %s row: %v", k33.TradeID, err)
+			continue
+		}
+		// A pending file should only hold half-trades, but keep anything
+		// that pairs up so it is still written out
+		c.carried = append(c.carried, c.settleFilled(&k33)...)
+		c.carried = append(c.carried, c.processTrade(k33, c.convertTimestamp(k33.Timestamp))...)
+	}
+}
+
+// writePending writes the legs of trades still unpaired at end of input as
+// a K33 CSV in the input's column layout, for LoadPending in a later run.
+func (c *Converter) writePending(out io.Writer) error {
+	ids := make([]string, 0, len(c.trades))
+	for id := range c.trades {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Written in the input's delimiter, like its columns, for LoadPending
+	writer := csv.NewWriter(out)
+	if c.InDelimiter != 0 {
+		writer.Comma = c.InDelimiter
+	}
+	if err := writer.Write(c.header); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		trade := c.trades[id]
+		legs := slices.Concat(trade.BuyLegs, trade.SellLegs, trade.FeeLegs)
+		for _, leg := range legs {
+			if err := writer.Write(c.rawRow(leg)); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestPendingTradesPairAcrossRuns(t *testing.T) {
+	run1 := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/30 10:00:00
+Trade,55,Buy,0.5,Filled,BTC,2023/01/31 23:59:59`
+
+	pending := &strings.Builder{}
+	conv := New()
+	conv.PendingOut = pending
+	if err := conv.Process(strings.NewReader(run1), &strings.Builder{}); err != nil {
+		t.Fatalf("Run 1 failed: %v", err)
+	}
+
+	expectedPending := "Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)\n" +
+		"Trade,55,Buy,0.5,Filled,BTC,2023/01/31 23:59:59\n"
+	if pending.String() != expectedPending {
+		t.Fatalf("Pending = %q, want %q", pending.String(), expectedPending)
+	}
+
+	run2 := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,55,Sell,-10000,Filled,USD,2023/02/01 00:00:01`
+
+	conv = New()
+	if err := conv.LoadPending(strings.NewReader(pending.String())); err != nil {
+		t.Fatalf("LoadPending failed: %v", err)
+	}
+	records, err := conv.parseRecords(strings.NewReader(run2))
+	if err != nil {
+		t.Fatalf("Run 2 failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Run 2: expected the completed trade, got %d records", len(records))
+	}
+	r := records[0]
+	if r.ReceivedAmount != "0.5" || r.ReceivedCurrency != "BTC" || r.SentAmount != "10000" || r.SentCurrency != "USD" {
+		t.Errorf("Completed trade = %+v", r)
+	}
+}
+
+func TestPendingUnitDivisor(t *testing.T) {
+	run1 := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,55,Buy,50000000,Filled,BTC,2023/01/31 23:59:59`
+	run2 := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,55,Sell,-10000,Filled,USD,2023/02/01 00:00:01`
+
+	divisors := map[string]*big.Rat{"BTC": big.NewRat(100000000, 1)}
+	pending := &strings.Builder{}
+	conv := New()
+	conv.UnitDivisors = divisors
+	conv.PendingOut = pending
+	if err := conv.Process(strings.NewReader(run1), io.Discard); err != nil {
+		t.Fatalf("Run 1 failed: %v", err)
+	}
+
+	conv = New()
+	conv.UnitDivisors = divisors
+	if err := conv.LoadPending(strings.NewReader(pending.String())); err != nil {
+		t.Fatalf("LoadPending failed: %v", err)
+	}
+	records, err := conv.parseRecords(strings.NewReader(run2))
+	if err != nil {
+		t.Fatalf("Run 2 failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ReceivedAmount != "0.5" || records[0].ReceivedCurrency != "BTC" {
+		t.Errorf("records = %+v, want one trade receiving 0.5 BTC", records)
+	}
+}
+
+func TestPendingDirectionLayout(t *testing.T) {
+	run1 := `Type/Status,TradeID,Direction,Amount,Asset,Timestamp (UTC)
+Trade,5,debit,0.5,BTC,2023/01/31 23:59:59`
+	run2 := `Type/Status,TradeID,Direction,Amount,Asset,Timestamp (UTC)
+Trade,5,credit,1000,USD,2023/02/01 00:00:01`
+
+	pending := &strings.Builder{}
+	conv := New()
+	conv.PendingOut = pending
+	if err := conv.Process(strings.NewReader(run1), io.Discard); err != nil {
+		t.Fatalf("Run 1 failed: %v", err)
+	}
+
+	conv = New()
+	if err := conv.LoadPending(strings.NewReader(pending.String())); err != nil {
+		t.Fatalf("LoadPending failed: %v", err)
+	}
+	records, err := conv.parseRecords(strings.NewReader(run2))
+	if err != nil {
+		t.Fatalf("Run 2 failed: %v", err)
+	}
+	if len(records) != 1 || records[0].SentCurrency != "BTC" || records[0].ReceivedCurrency != "USD" {
+		t.Errorf("records = %+v, want one BTC->USD trade", records)
+	}
+	if conv.Stats().Rejected != 0 {
+		t.Errorf("Stats = %s, want the pending leg kept", conv.Stats())
+	}
+}
+
+func TestReportsAlignReorderedInputs(t *testing.T) {
+	january := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/15 10:30:45`
+	february := `Asset,Timestamp (UTC),Type/Status,TradeID,Side,Amount,Trade Status
+BTC,2023/01/16 10:30:45,Trade,2,Buy,0.1,Filled
+BTC,2023/01/16 10:31:45,Trade,3,Sell,-0.1,Rejected
+XYZ,2023/01/17 10:30:45,Airdrop Pending,,,5,`
+
+	conv := New()
+	conv.LogLevel = LogQuiet
+	var pending, rejects, unrecognized strings.Builder
+	conv.PendingOut = &pending
+	conv.RejectsReport = &rejects
+	conv.UnrecognizedReport = &unrecognized
+	if err := conv.ProcessAll([]io.Reader{strings.NewReader(january), strings.NewReader(february)}, io.Discard); err != nil {
+		t.Fatalf("ProcessAll failed: %v", err)
+	}
+
+	header := "Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)"
+	if want := header + "\nTrade,2,Buy,0.1,Filled,BTC,2023/01/16 10:30:45\n"; pending.String() != want {
+		t.Errorf("pending =\n%s\nwant\n%s", pending.String(), want)
+	}
+	want := header + `,Reason
+Trade,3,Sell,-0.1,Rejected,BTC,2023/01/16 10:31:45,rejected status
+Airdrop Pending,,,5,,XYZ,2023/01/17 10:30:45,unrecognized Type/Status
+Trade,2,Buy,0.1,Filled,BTC,2023/01/16 10:30:45,unpaired trade
+`
+	if rejects.String() != want {
+		t.Errorf("rejects =\n%s\nwant\n%s", rejects.String(), want)
+	}
+	if want := "Unrecognized Type/Status,Count," + header + "\nAirdrop Pending,1,Airdrop Pending,,,5,,XYZ,2023/01/17 10:30:45\n"; unrecognized.String() != want {
+		t.Errorf("unrecognized =\n%s\nwant\n%s", unrecognized.String(), want)
+	}
+
+	// The pending file reads back as the same leg
+	next := New()
+	if err := next.LoadPending(strings.NewReader(pending.String())); err != nil {
+		t.Fatalf("LoadPending failed: %v", err)
+	}
+	records, err := next.parseRecords(strings.NewReader(header + "\nTrade,2,Sell,-1000,Filled,USD,2023/01/16 10:30:45"))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ReceivedAmount != "0.1" || records[0].ReceivedCurrency != "BTC" {
+		t.Errorf("records = %+v, want the reloaded BTC leg paired", records)
+	}
+}
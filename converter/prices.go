@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PriceTable holds daily asset prices keyed by asset and date.
+type PriceTable map[priceKey]Price
+
+type priceKey struct {
+	asset string
+	date  string // YYYY-MM-DD
+}
+
+// Price is the value of one unit of an asset in Currency.
+type Price struct {
+	Currency string
+	Value    *big.Rat
+}
+
+// LoadPrices reads a price CSV with the columns date,asset,currency,price,
+// where date is YYYY-MM-DD. A header row is optional.
+func LoadPrices(in io.Reader) (PriceTable, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = 4
+
+	prices := make(PriceTable)
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return prices, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading prices: %w", err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(row[0]), "date") {
+			continue
+		}
+
+		date := strings.TrimSpace(row[0])
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("prices line %d: invalid date %q", line, row[0])
+		}
+		value, err := parseAmount(row[3])
+		if err != nil {
+			return nil, fmt.Errorf("prices line %d: %w", line, err)
+		}
+
+		key := priceKey{asset: strings.ToUpper(strings.TrimSpace(row[1])), date: date}
+		prices[key] = Price{Currency: strings.ToUpper(strings.TrimSpace(row[2])), Value: value}
+	}
+}
+
+// Lookup returns the price of asset on the day of t.
+func (p PriceTable) Lookup(asset string, t time.Time) (Price, bool) {
+	price, ok := p[priceKey{asset: strings.ToUpper(asset), date: t.Format(time.DateOnly)}]
+	return price, ok
+}
+
+// reconstructQuoteLeg fills in the missing leg of a single-legged trade by
+// valuing the present leg with c.Prices. It reports whether the trade now
+// has both legs.
+func (c *Converter) reconstructQuoteLeg(trade *TradePair) bool {
+	legs := trade.BuyLegs
+	if len(legs) == 0 {
+		legs = trade.SellLegs
+	}
+	if len(legs) == 0 || (len(trade.BuyLegs) > 0 && len(trade.SellLegs) > 0) {
+		return false
+	}
+	leg := legs[0]
+
+	t, err := parseTimestamp(leg.Timestamp)
+	if err != nil {
+		return false
+	}
+	price, ok := c.Prices.Lookup(leg.Asset, t)
+	if !ok {
+		return false
+	}
+	amount, err := parseAmount(fillTotal(legs))
+	if err != nil {
+		return false
+	}
+
+	quote := &K33Record{
+		TypeStatus:  leg.TypeStatus,
+		TradeID:     leg.TradeID,
+		TradeStatus: leg.TradeStatus,
+		Asset:       price.Currency,
+		Amount:      formatAmount(new(big.Rat).Mul(amount, price.Value)),
+		Timestamp:   leg.Timestamp,
+	}
+	if len(trade.BuyLegs) > 0 {
+		quote.Side = "Sell"
+		trade.SellLegs = []*K33Record{quote}
+	} else {
+		quote.Side = "Buy"
+		trade.BuyLegs = []*K33Record{quote}
+	}
+
+	c.warnf("Trade %s quote leg reconstructed from price data: %s %s", trade.TradeID, quote.Amount, quote.Asset)
+	return true
+}
+
+// priceTolerance is the relative difference allowed between a leg's
+// stated Price and the price implied by the trade's amounts.
+var priceTolerance = big.NewRat(1, 100)
+
+// checkTradePrice warns when a trade leg states an execution Price that
+// the trade's amounts do not bear out, which points at mispaired legs. The
+// price may be quoted either way round, so either ratio of the amounts
+// may match it.
+func (c *Converter) checkTradePrice(trade *TradePair, record KoinlyRecord) {
+	var stated string
+	for _, leg := range slices.Concat(trade.SellLegs, trade.BuyLegs) {
+		if leg.Price != "" {
+			stated = leg.Price
+			break
+		}
+	}
+	if stated == "" {
+		return
+	}
+	price, err := parseAmount(stated)
+	sent, sentErr := parseAmount(record.SentAmount)
+	received, receivedErr := parseAmount(record.ReceivedAmount)
+	if err != nil || sentErr != nil || receivedErr != nil || price.Sign() <= 0 || sent.Sign() == 0 || received.Sign() == 0 {
+		return
+	}
+
+	tolerance := new(big.Rat).Mul(price, priceTolerance)
+	for _, implied := range []*big.Rat{new(big.Rat).Quo(sent, received), new(big.Rat).Quo(received, sent)} {
+		if diff := implied.Sub(implied, price); diff.Abs(diff).Cmp(tolerance) <= 0 {
+			return
+		}
+	}
+	c.warnf("Trade %s price %s does not match its amounts (%s %s for %s %s); check the leg pairing",
+		trade.TradeID, stated, record.SentAmount, record.SentCurrency, record.ReceivedAmount, record.ReceivedCurrency)
+}
@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testPrices = `date,asset,currency,price
+2023-01-15,BTC,USD,20000.50`
+
+func TestLoadPrices(t *testing.T) {
+	prices, err := LoadPrices(strings.NewReader(testPrices))
+	if err != nil {
+		t.Fatalf("LoadPrices failed: %v", err)
+	}
+	ts, _ := parseTimestamp("2023/01/15 10:30:45")
+	price, ok := prices.Lookup("btc", ts)
+	if !ok {
+		t.Fatal("Expected BTC price for 2023-01-15")
+	}
+	if price.Currency != "USD" || formatAmount(price.Value) != "20000.5" {
+		t.Errorf("Price = %s %s, want 20000.5 USD", formatAmount(price.Value), price.Currency)
+	}
+
+	if _, err := LoadPrices(strings.NewReader("2023/01/15,BTC,USD,1")); err == nil {
+		t.Error("Expected error for invalid price date")
+	}
+}
+
+func TestSingleLegTradeCompletedFromPrices(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,99,Buy,0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,100,Buy,1,Filled,ETH,2023/01/15 10:30:45`
+
+	prices, err := LoadPrices(strings.NewReader(testPrices))
+	if err != nil {
+		t.Fatalf("LoadPrices failed: %v", err)
+	}
+	conv := New()
+	conv.Prices = prices
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 reconstructed trade, got %d: %+v", len(records), records)
+	}
+
+	r := records[0]
+	if r.ReceivedAmount != "0.5" || r.ReceivedCurrency != "BTC" {
+		t.Errorf("Received = %s %s, want 0.5 BTC", r.ReceivedAmount, r.ReceivedCurrency)
+	}
+	if r.SentAmount != "10000.25" || r.SentCurrency != "USD" {
+		t.Errorf("Sent = %s %s, want 10000.25 USD", r.SentAmount, r.SentCurrency)
+	}
+	if _, pending := conv.trades["100"]; !pending {
+		t.Error("Expected ETH trade without a price to stay unpaired")
+	}
+}
+
+func TestTradePriceCrossCheck(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Price,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,20000,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,10050,20000,Filled,USD,2023/01/15 10:30:45
+Trade,2,Sell,-3000,0.0005,Filled,USD,2023/01/15 10:31:45
+Trade,2,Buy,1.5,0.0005,Filled,BTC,2023/01/15 10:31:45
+Trade,3,Sell,-0.5,20000,Filled,BTC,2023/01/15 10:32:45
+Trade,3,Buy,1500,20000,Filled,USD,2023/01/15 10:32:45`
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Mismatched trades should still convert, got %d records", len(records))
+	}
+
+	// Trade 1 is within tolerance, trade 2 quotes the price the other way
+	// round and trade 3 is far off
+	if strings.Contains(logs.String(), "Trade 1 price") || strings.Contains(logs.String(), "Trade 2 price") {
+		t.Errorf("Unexpected price warning:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "Trade 3 price 20000 does not match its amounts") {
+		t.Errorf("Missing price mismatch warning:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// defaultRejectStatuses are the terminal Trade Status values, in lower
+// case, whose rows are skipped without converting.
+var defaultRejectStatuses = map[string]bool{
+	"reject":    true,
+	"rejected":  true,
+	"cancelled": true,
+	"failed":    true,
+}
+
+// DefaultRejectStatuses returns a copy of the built-in reject statuses,
+// for extending Converter.RejectStatuses.
+func DefaultRejectStatuses() map[string]bool {
+	return maps.Clone(defaultRejectStatuses)
+}
+
+// isRejectStatus reports whether a row's Trade Status marks it as never
+// filled, ignoring case.
+func (c *Converter) isRejectStatus(k33 K33Record) bool {
+	statuses := c.RejectStatuses
+	if statuses == nil {
+		statuses = defaultRejectStatuses
+	}
+	return statuses[strings.ToLower(strings.TrimSpace(k33.TradeStatus))]
+}
+
+// Reject is input left out of the output because it could not be
+// converted into a valid row.
+type Reject struct {
+	Reason string
+	Rows   [][]string // original K33 rows, where known
+}
+
+// Rejects returns everything rejected by the conversions run so far.
+func (c *Converter) Rejects() []Reject {
+	return c.rejects
+}
+
+// reject records legs as rejected for reason.
+func (c *Converter) reject(reason string, legs ...*K33Record) {
+	r := Reject{Reason: reason}
+	for _, leg := range legs {
+		if leg != nil && leg.raw != nil {
+			r.Rows = append(r.Rows, leg.raw)
+		}
+	}
+	c.rejects = append(c.rejects, r)
+	c.exclude(reason, legs...)
+	c.stats.Rejected++
+	c.badRows++
+	c.warnf("Rejecting row: %s", reason)
+}
+
+// excludedRow is an input row left out of the output, for RejectsReport.
+type excludedRow struct {
+	reason string
+	row    []string
+}
+
+// exclude notes the rows of legs as left out of the output for reason.
+// Rows are only kept when they will be reported.
+func (c *Converter) exclude(reason string, legs ...*K33Record) {
+	if c.RejectsReport == nil {
+		return
+	}
+	for _, leg := range legs {
+		if leg != nil && leg.raw != nil {
+			c.excluded = append(c.excluded, excludedRow{reason: reason, row: c.rawRow(leg)})
+		}
+	}
+}
+
+// writeRejectsReport writes the rows left out of the last conversion, in
+// the order they were left out (unpaired trades last), as the original K33
+// columns plus a Reason column.
+func (c *Converter) writeRejectsReport(out io.Writer) error {
+	writer := csv.NewWriter(out)
+	if err := writer.Write(append(slices.Clone(c.header), "Reason")); err != nil {
+		return err
+	}
+	for _, e := range c.excluded {
+		if err := writer.Write(append(e.row, e.reason)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// TooManyErrors is returned once more rows than MaxErrors could not be
+// converted.
+type TooManyErrors struct {
+	Count, Max int
+}
+
+func (e *TooManyErrors) Error() string {
+	return fmt.Sprintf("too many bad rows: %d, more than the %d allowed", e.Count, e.Max)
+}
+
+// checkErrorBudget fails the conversion once the bad rows seen so far
+// exceed c.MaxErrors.
+func (c *Converter) checkErrorBudget() error {
+	if c.MaxErrors >= 0 && c.badRows > c.MaxErrors {
+		return &TooManyErrors{Count: c.badRows, Max: c.MaxErrors}
+	}
+	return nil
+}
+
+// UnpairedTrades lists the trades left with a single leg at end of input,
+// by pairing id, so the source data can be fixed.
+type UnpairedTrades struct {
+	BuyOnly  []string // trades with only a buy leg
+	SellOnly []string // trades with only a sell leg
+}
+
+// Count returns how many trades are unpaired.
+func (u *UnpairedTrades) Count() int {
+	return len(u.BuyOnly) + len(u.SellOnly)
+}
+
+func (u *UnpairedTrades) Error() string {
+	var parts []string
+	if len(u.BuyOnly) > 0 {
+		parts = append(parts, fmt.Sprintf("%d with only a buy leg (%s)", len(u.BuyOnly), strings.Join(u.BuyOnly, ", ")))
+	}
+	if len(u.SellOnly) > 0 {
+		parts = append(parts, fmt.Sprintf("%d with only a sell leg (%s)", len(u.SellOnly), strings.Join(u.SellOnly, ", ")))
+	}
+	return fmt.Sprintf("%d unpaired trades need review: %s", u.Count(), strings.Join(parts, "; "))
+}
+
+// tradeProblem returns why a trade record is invalid in Koinly, or "" if
+// it is not. Both sides need an amount and a currency.
+func tradeProblem(r KoinlyRecord) string {
+	switch {
+	case r.SentAmount == "" || r.SentCurrency == "":
+		return "trade " + r.Description + " is missing its sent amount"
+	case r.ReceivedAmount == "" || r.ReceivedCurrency == "":
+		return "trade " + r.Description + " is missing its received amount"
+	}
+	return ""
+}
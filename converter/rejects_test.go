@@ -0,0 +1,194 @@
+package converter
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTradeMissingSentAmountRejected(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,7,Sell,,Filled,BTC,2023/01/15 10:30:45
+Trade,7,Buy,1000,Filled,USD,2023/01/15 10:30:45`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected invalid trade to be left out, got %+v", records)
+	}
+
+	rejects := conv.Rejects()
+	if len(rejects) != 1 {
+		t.Fatalf("Expected 1 reject, got %d", len(rejects))
+	}
+	if !strings.Contains(rejects[0].Reason, "missing its sent amount") {
+		t.Errorf("Reason = %q, want a missing sent amount", rejects[0].Reason)
+	}
+	if len(rejects[0].Rows) != 2 || rejects[0].Rows[0][2] != "Sell" {
+		t.Errorf("Reject rows = %v, want both original legs", rejects[0].Rows)
+	}
+}
+
+func TestStrictUnpairedTrades(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,3,Buy,1000,Filled,USD,2023/01/15 10:30:45
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:31:45
+Trade,2,Sell,-0.1,Filled,BTC,2023/01/15 10:32:45`
+
+	// Without Strict the run succeeds with a summary warning
+	if err := New().Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	conv := New()
+	conv.Strict = true
+	err := conv.Process(strings.NewReader(input), &strings.Builder{})
+	var unpaired *UnpairedTrades
+	if !errors.As(err, &unpaired) {
+		t.Fatalf("Expected an UnpairedTrades error, got %v", err)
+	}
+	if !slices.Equal(unpaired.BuyOnly, []string{"3"}) || !slices.Equal(unpaired.SellOnly, []string{"1", "2"}) {
+		t.Errorf("Unpaired = %+v, want buy-only 3 and sell-only 1, 2", unpaired)
+	}
+	want := "3 unpaired trades need review: 1 with only a buy leg (3); 2 with only a sell leg (1, 2)"
+	if err.Error() != want {
+		t.Errorf("Error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestRejectStatusesIgnoreCase(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-1,REJECT,BTC,2023/01/15 10:30:45
+Trade,1,Buy,1000,rejected,USD,2023/01/15 10:30:45
+Trade,2,Sell,-1,Cancelled,BTC,2023/01/15 10:31:45
+Trade,2,Buy,1000,failed,USD,2023/01/15 10:31:45
+Trade,3,Sell,-1,Expired,BTC,2023/01/15 10:32:45
+Trade,3,Buy,1000,EXPIRED,USD,2023/01/15 10:32:45
+Trade,4,Sell,-1,Filled,BTC,2023/01/15 10:33:45
+Trade,4,Buy,1000,Filled,USD,2023/01/15 10:33:45`
+
+	conv := New()
+	conv.RejectStatuses = DefaultRejectStatuses()
+	conv.RejectStatuses["expired"] = true
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Description != "Trade (K33) - 4" {
+		t.Fatalf("want only trade 4, got %+v", records)
+	}
+	if conv.stats.Rejected != 6 {
+		t.Errorf("Rejected = %d, want 6", conv.stats.Rejected)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,1,,BTC,2023/01/15 10:30:45
+Deposit Complete,,,2,,BTC,2023/01/15 10:31:45,extra
+Deposit Complete,,,n/a,,BTC,2023/01/15 10:32:45
+Deposit Complete,,,3,,BTC,2023/01/15 10:33:45`
+
+	// without a budget a malformed row fails the conversion
+	if _, err := New().parseRecords(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "reading record") {
+		t.Errorf("no budget: err = %v, want a reading record error", err)
+	}
+
+	conv := New()
+	conv.MaxErrors = 2
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("within budget: parseRecords failed: %v", err)
+	}
+	if len(records) != 2 || records[0].ReceivedAmount != "1" || records[1].ReceivedAmount != "3" {
+		t.Errorf("within budget: got %+v, want the two valid deposits", records)
+	}
+
+	conv = New()
+	conv.MaxErrors = 1
+	_, err = conv.parseRecords(strings.NewReader(input))
+	var tooMany *TooManyErrors
+	if !errors.As(err, &tooMany) || tooMany.Count != 2 || tooMany.Max != 1 {
+		t.Errorf("over budget: err = %v, want TooManyErrors{2, 1}", err)
+	}
+
+	// read errors are fatal whatever the budget
+	failing := io.MultiReader(strings.NewReader(input[:strings.Index(input, "\n")+1]), iotest.ErrReader(errors.New("disk gone")))
+	conv = New()
+	conv.MaxErrors = 10
+	if _, err := conv.parseRecords(failing); err == nil || !strings.Contains(err.Error(), "disk gone") {
+		t.Errorf("read error: err = %v, want it returned", err)
+	}
+}
+
+func TestRejectsReport(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/14 10:30:45
+Trade,1,Sell,-0.5,Rejected,BTC,2023/01/15 10:30:45
+Deposit Complete,,,n/a,,USD,2023/01/15 10:31:45
+Deposit Complete,,,5,,USD,
+Trade,2,Buy,0.1,Filled,BTC,2023/01/16 10:30:45
+Airdrop Pending,,,5,,XYZ,2023/01/17 10:30:45`
+
+	conv := New()
+	var report strings.Builder
+	conv.RejectsReport = &report
+	if err := conv.Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	want := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Reason
+Trade,1,Sell,-0.5,Rejected,BTC,2023/01/15 10:30:45,rejected status
+Deposit Complete,,,n/a,,USD,2023/01/15 10:31:45,"invalid amount ""n/a"""
+Deposit Complete,,,5,,USD,,empty timestamp
+Airdrop Pending,,,5,,XYZ,2023/01/17 10:30:45,unrecognized Type/Status
+Trade,2,Buy,0.1,Filled,BTC,2023/01/16 10:30:45,unpaired trade
+`
+	if got := report.String(); got != want {
+		t.Errorf("rejects report =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRejectsReportCoversDroppedTrades(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/14 10:30:45
+Deposit Pending,,,50,,USD,2023/01/14 10:31:45
+Trade,,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,2,Long,0.1,Filled,BTC,2023/01/16 10:30:45
+Trade,3,sell,-0.2,Filled,BTC,2023/01/17 10:30:45
+Trade,3,BUY,400,Filled,USD,2023/01/17 10:30:45`
+
+	conv := New()
+	conv.LogLevel = LogQuiet
+	conv.StrictDepositStatus = true
+	var report, out strings.Builder
+	conv.RejectsReport = &report
+	if err := conv.Process(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	want := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Reason
+Deposit Pending,,,50,,USD,2023/01/14 10:31:45,non-final deposit status
+Trade,,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,trade row has no TradeID or OrderID
+Trade,2,Long,0.1,Filled,BTC,2023/01/16 10:30:45,"trade 2 row has Side ""Long"", want Buy or Sell"
+`
+	if got := report.String(); got != want {
+		t.Errorf("rejects report =\n%s\nwant\n%s", got, want)
+	}
+	// Sides are matched ignoring case
+	if !strings.Contains(out.String(), "2023-01-17 10:30:45,0.2,BTC,400,USD,") {
+		t.Errorf("want trade 3 paired from its sell and BUY rows, got:\n%s", out.String())
+	}
+	if got := conv.Stats(); got.Rejected != 2 || got.Skipped != 1 || got.Trades != 1 {
+		t.Errorf("Stats = %+v, want 2 rejected, 1 skipped and 1 trade", got)
+	}
+	if conv.Warnings() == 0 {
+		t.Error("want the dropped rows warned about")
+	}
+}
@@ -0,0 +1,275 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// resetOutput clears what observe accumulated for a previous conversion.
+func (c *Converter) resetOutput() {
+	c.written = outputSummary{}
+	c.fees = make(map[string]*big.Rat)
+	c.daily = make(map[dailyKey]*dailyTotals)
+	c.amounts = make(map[string][]*big.Rat)
+	c.unknownCurrencies = nil
+	c.human = nil
+	c.stats = Stats{}
+	c.badRows = 0
+	c.excluded = nil
+	c.seen = make(map[[sha256.Size]byte]bool)
+	if c.HumanOut != nil {
+		c.human = c.newWriter(c.HumanOut)
+		c.human.Write(humanHeader)
+	}
+}
+
+// observe accumulates what the side reports need from a written record,
+// so records can be streamed rather than kept.
+func (c *Converter) observe(r KoinlyRecord) {
+	c.written.add(r)
+	c.addFee(c.fees, r)
+	if c.VerboseStats != nil {
+		addAmounts(c.amounts, r)
+	}
+	if c.DailySummary != nil {
+		c.addDaily(c.daily, r)
+	}
+	if c.human != nil {
+		c.human.Write(humanRow(r))
+	}
+}
+
+// writeReports writes the optional side reports configured on c for the
+// records written by the last conversion. Under Strict it then fails with
+// the unpaired trades, so they are still explained first.
+func (c *Converter) writeReports() error {
+	if c.human != nil {
+		c.human.Flush()
+		if err := c.human.Error(); err != nil {
+			return fmt.Errorf("writing human-readable output: %w", err)
+		}
+	}
+	if c.FeeReport != nil {
+		if err := writeFeeReport(c.FeeReport, c.fees); err != nil {
+			return fmt.Errorf("writing fee report: %w", err)
+		}
+	}
+	if c.DailySummary != nil {
+		if err := writeDailySummary(c.DailySummary, c.daily); err != nil {
+			return fmt.Errorf("writing daily summary: %w", err)
+		}
+	}
+	if c.PendingOut != nil {
+		if err := c.writePending(c.PendingOut); err != nil {
+			return fmt.Errorf("writing pending trades: %w", err)
+		}
+	}
+	if c.VerboseStats != nil {
+		if err := writeAmountStats(c.VerboseStats, c.amounts); err != nil {
+			return fmt.Errorf("writing amount stats: %w", err)
+		}
+	}
+	if c.ExplainUnpaired != nil {
+		if err := c.explainUnpaired(c.ExplainUnpaired); err != nil {
+			return fmt.Errorf("writing unpaired explanation: %w", err)
+		}
+	}
+	if c.RejectsReport != nil {
+		if err := c.writeRejectsReport(c.RejectsReport); err != nil {
+			return fmt.Errorf("writing rejects report: %w", err)
+		}
+	}
+	if c.UnrecognizedReport != nil {
+		if err := c.writeUnrecognizedReport(c.UnrecognizedReport); err != nil {
+			return fmt.Errorf("writing unrecognized report: %w", err)
+		}
+	}
+	if c.Strict && c.unpaired.Count() > 0 {
+		return &c.unpaired
+	}
+	return nil
+}
+
+// explainUnpaired writes one block per trade left unpaired, sorted by
+// pairing id, naming the side that is present and that leg's fields.
+func (c *Converter) explainUnpaired(out io.Writer) error {
+	ids := make([]string, 0, len(c.trades))
+	for id := range c.trades {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		trade := c.trades[id]
+		legs, present, missing := trade.BuyLegs, "buy", "sell"
+		if len(legs) == 0 {
+			legs, present, missing = trade.SellLegs, "sell", "buy"
+		}
+		if len(legs) == 0 {
+			continue
+		}
+		leg := legs[0]
+		_, err := fmt.Fprintf(out, "Unpaired trade %s: %s leg present, %s leg missing\n"+
+			"  TradeID: %s\n  OrderID: %s\n  Side: %s\n  Amount: %s\n  Asset: %s\n"+
+			"  Timestamp: %s\n  Trade Status: %s\n  UniqueKey: %s\n",
+			id, present, missing,
+			leg.TradeID, leg.OrderID, leg.Side, leg.Amount, leg.Asset,
+			leg.Timestamp, leg.TradeStatus, leg.UniqueKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unrecognizedType tracks a Type/Status value the converter has no mapping for.
+type unrecognizedType struct {
+	count  int
+	sample []string
+}
+
+// recordUnrecognized notes a row whose Type/Status is not handled, keeping
+// the first row seen as a sample.
+func (c *Converter) recordUnrecognized(k33 K33Record) {
+	if c.unrecognized == nil {
+		c.unrecognized = make(map[string]*unrecognizedType)
+	}
+	u, ok := c.unrecognized[k33.TypeStatus]
+	if !ok {
+		c.warnf("Unrecognized Type/Status %q", k33.TypeStatus)
+		u = &unrecognizedType{sample: c.rawRow(&k33)}
+		c.unrecognized[k33.TypeStatus] = u
+	}
+	u.count++
+	c.exclude("unrecognized Type/Status", &k33)
+	c.stats.Unrecognized++
+}
+
+// writeUnrecognizedReport writes one CSV row per unrecognized Type/Status:
+// the value, how often it occurred, and the first sample row in the
+// original K33 columns.
+func (c *Converter) writeUnrecognizedReport(out io.Writer) error {
+	types := make([]string, 0, len(c.unrecognized))
+	for typeStatus := range c.unrecognized {
+		types = append(types, typeStatus)
+	}
+	sort.Strings(types)
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write(append([]string{"Unrecognized Type/Status", "Count"}, c.header...)); err != nil {
+		return err
+	}
+	for _, typeStatus := range types {
+		u := c.unrecognized[typeStatus]
+		row := append([]string{typeStatus, strconv.Itoa(u.count)}, u.sample...)
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// addFee adds r's fee to the per-currency totals. A cost row, a fee that
+// did not fit on its trade or withdrawal, counts its sent amount.
+func (c *Converter) addFee(totals map[string]*big.Rat, r KoinlyRecord) {
+	amount, currency := r.FeeAmount, r.FeeCurrency
+	if r.Label == "cost" {
+		amount, currency = r.SentAmount, r.SentCurrency
+	}
+	if amount == "" {
+		return
+	}
+	fee, err := parseAmount(amount)
+	if err != nil {
+		c.warnf("Ignoring fee %q in fee report: %v", amount, err)
+		return
+	}
+	if totals[currency] == nil {
+		totals[currency] = new(big.Rat)
+	}
+	totals[currency].Add(totals[currency], fee)
+}
+
+// writeFeeReport writes one CSV row per fee currency, sorted by currency.
+func writeFeeReport(out io.Writer, totals map[string]*big.Rat) error {
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write([]string{"Currency", "Total Fee"}); err != nil {
+		return err
+	}
+	for _, currency := range currencies {
+		if err := writer.Write([]string{currency, formatAmount(totals[currency])}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// addAmounts collects r's sent and received amounts per currency.
+func addAmounts(amounts map[string][]*big.Rat, r KoinlyRecord) {
+	for _, side := range [][2]string{{r.SentAmount, r.SentCurrency}, {r.ReceivedAmount, r.ReceivedCurrency}} {
+		if side[0] == "" || side[1] == "" {
+			continue
+		}
+		amount, err := parseAmount(side[0])
+		if err != nil {
+			continue
+		}
+		amounts[side[1]] = append(amounts[side[1]], amount)
+	}
+}
+
+// median returns the middle of sorted amounts, averaging the two middle
+// values of an even count.
+func median(sorted []*big.Rat) *big.Rat {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	m := new(big.Rat).Add(sorted[mid-1], sorted[mid])
+	return m.Quo(m, big.NewRat(2, 1))
+}
+
+// writeAmountStats writes the count, min, median and max amount per asset,
+// sorted by asset, for spotting outliers before import.
+func writeAmountStats(out io.Writer, amounts map[string][]*big.Rat) error {
+	assets := make([]string, 0, len(amounts))
+	for asset := range amounts {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write([]string{"Asset", "Count", "Min", "Median", "Max"}); err != nil {
+		return err
+	}
+	for _, asset := range assets {
+		sorted := amounts[asset]
+		slices.SortFunc(sorted, func(a, b *big.Rat) int { return a.Cmp(b) })
+		row := []string{
+			asset,
+			strconv.Itoa(len(sorted)),
+			formatAmount(sorted[0]),
+			formatAmount(median(sorted)),
+			formatAmount(sorted[len(sorted)-1]),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,91 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFeeReport(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,0.001,BTC
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45,,
+Trade,2,Sell,-0.25,Filled,BTC,2023/01/16 10:30:45,0.0005,BTC
+Trade,2,Buy,500,Filled,USD,2023/01/16 10:30:45,,
+Trade,3,Sell,-100,Filled,USD,2023/01/17 10:30:45,1.5,USD
+Trade,3,Buy,0.1,Filled,ETH,2023/01/17 10:30:45,,`
+
+	report := &strings.Builder{}
+	conv := New()
+	conv.FeeReport = report
+	if err := conv.Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	expected := "Currency,Total Fee\nBTC,0.0015\nUSD,1.5\n"
+	if report.String() != expected {
+		t.Errorf("Fee report = %q, want %q", report.String(), expected)
+	}
+}
+
+func TestVerboseStatsMedian(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,0.3,BTC,2023/01/15 10:30:45
+Deposit Complete,0.1,BTC,2023/01/16 10:30:45
+Withdrawal Complete,-5,BTC,2023/01/17 10:30:45
+Deposit Complete,0.2,BTC,2023/01/18 10:30:45
+Deposit Complete,100,USD,2023/01/19 10:30:45
+Deposit Complete,300,USD,2023/01/20 10:30:45`
+
+	report := &strings.Builder{}
+	conv := New()
+	conv.VerboseStats = report
+	if err := conv.Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	expected := "Asset,Count,Min,Median,Max\nBTC,4,0.1,0.25,5\nUSD,2,100,200,300\n"
+	if report.String() != expected {
+		t.Errorf("Stats = %q, want %q", report.String(), expected)
+	}
+}
+
+func TestExplainUnpaired(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),UniqueKey
+Trade,42,Buy,1000,Filled,USD,2023/01/15 10:30:45,k42
+Trade,43,Sell,-1,Filled,ETH,2023/01/16 10:30:45,k43
+Trade,43,Buy,200,Filled,USD,2023/01/16 10:30:45,k43`
+
+	report := &strings.Builder{}
+	conv := New()
+	conv.ExplainUnpaired = report
+	if err := conv.Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	expected := "Unpaired trade 42: buy leg present, sell leg missing\n" +
+		"  TradeID: 42\n  OrderID: \n  Side: Buy\n  Amount: 1000\n  Asset: USD\n" +
+		"  Timestamp: 2023/01/15 10:30:45\n  Trade Status: Filled\n  UniqueKey: k42\n"
+	if report.String() != expected {
+		t.Errorf("Explanation = %q, want %q", report.String(), expected)
+	}
+}
+
+func TestUnrecognizedReport(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC)
+Deposit Complete,100,USD,2023/01/15 10:30:45
+Airdrop Complete,5,XYZ,2023/01/16 10:30:45
+Airdrop Complete,7,XYZ,2023/01/17 10:30:45`
+
+	report := &strings.Builder{}
+	conv := New()
+	conv.UnrecognizedReport = report
+	if err := conv.Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	expected := "Unrecognized Type/Status,Count,Type/Status,Amount,Asset,Timestamp (UTC)\n" +
+		"Airdrop Complete,2,Airdrop Complete,5,XYZ,2023/01/16 10:30:45\n"
+	if report.String() != expected {
+		t.Errorf("Unrecognized report = %q, want %q", report.String(), expected)
+	}
+}
@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+)
+
+// LatestSchema names the most recent known K33 export layout.
+const LatestSchema = "v1"
+
+// k33Schemas are the known K33 export headers, by version, in column order.
+var k33Schemas = map[string][]string{
+	"v1": {
+		"Type/Status", "TradeID", "Side", "Amount", "Trade Status", "Asset",
+		"Credit_old", "Credit Balance", "Funded_old", "Funded Balance",
+		"PndWithdrawal_old", "PndWithdrawal Balance", "Total_old", "Total Balance",
+		"Timestamp (UTC)", "UniqueKey", "InternalReportID",
+		"DepositTxhash", "WithdrawalTxhash", "SourceAddress", "DestinationAddress",
+	},
+}
+
+// assertSchema checks that header exactly matches the named K33 schema.
+func assertSchema(version string, header []string) error {
+	if version == "latest" {
+		version = LatestSchema
+	}
+	expected, ok := k33Schemas[version]
+	if !ok {
+		return fmt.Errorf("unknown K33 schema %q", version)
+	}
+
+	clean := make([]string, len(header))
+	for i, col := range header {
+		clean[i] = cleanColumn(col)
+	}
+	if slices.Equal(clean, expected) {
+		return nil
+	}
+
+	for i := 0; i < max(len(clean), len(expected)); i++ {
+		switch {
+		case i >= len(clean):
+			return fmt.Errorf("header does not match K33 schema %s: missing column %q", version, expected[i])
+		case i >= len(expected):
+			return fmt.Errorf("header does not match K33 schema %s: unexpected column %q", version, clean[i])
+		case clean[i] != expected[i]:
+			return fmt.Errorf("header does not match K33 schema %s: column %d is %q, want %q", version, i+1, clean[i], expected[i])
+		}
+	}
+	return nil
+}
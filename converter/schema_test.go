@@ -0,0 +1,28 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertColumns(t *testing.T) {
+	conv := New()
+	conv.AssertColumns = LatestSchema
+	if err := conv.Process(strings.NewReader(testCSVInput), &strings.Builder{}); err != nil {
+		t.Fatalf("Expected known schema to pass, got %v", err)
+	}
+
+	changed := strings.Replace(testCSVInput, "UniqueKey", "UniqueKeyV2", 1)
+	conv = New()
+	conv.AssertColumns = LatestSchema
+	err := conv.Process(strings.NewReader(changed), &strings.Builder{})
+	if err == nil || !strings.Contains(err.Error(), `"UniqueKeyV2"`) {
+		t.Errorf("Expected schema assertion error naming the changed column, got %v", err)
+	}
+
+	conv = New()
+	conv.AssertColumns = "v0"
+	if err := conv.Process(strings.NewReader(testCSVInput), &strings.Builder{}); err == nil {
+		t.Error("Expected error for unknown schema version")
+	}
+}
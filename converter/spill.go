@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// spilledRecord is the temp-file form of a buffered record. Only the
+// fields still needed after recordStream.flush are kept.
+type spilledRecord struct {
+	KoinlyRecord
+	Kind string    `json:"kind,omitempty"`
+	At   time.Time `json:"at"`
+}
+
+// spill sorts the buffered records and writes them to a new temp file as
+// one run of JSON lines.
+func (s *recordStream) spill() error {
+	if len(s.sorted) == 0 {
+		return nil
+	}
+	f, err := os.CreateTemp("", "k33-to-koinly-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("creating spill file: %w", err)
+	}
+	s.runs = append(s.runs, f)
+
+	s.c.sortRecords(s.sorted)
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range s.sorted {
+		if err := enc.Encode(spilledRecord{r, r.kind, r.at}); err != nil {
+			return fmt.Errorf("writing spill file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing spill file: %w", err)
+	}
+	s.sorted = s.sorted[:0]
+	return nil
+}
+
+// spillRun reads back one spilled run, one record ahead.
+type spillRun struct {
+	dec  *json.Decoder
+	next KoinlyRecord
+	done bool
+}
+
+func (r *spillRun) advance() error {
+	var rec spilledRecord
+	if err := r.dec.Decode(&rec); err != nil {
+		if errors.Is(err, io.EOF) {
+			r.done = true
+			return nil
+		}
+		return fmt.Errorf("reading spill file: %w", err)
+	}
+	r.next = rec.KoinlyRecord
+	r.next.kind, r.next.at = rec.Kind, rec.At
+	return nil
+}
+
+// merge writes the spilled runs as one sorted sequence. Equal records
+// are taken from the earliest run, which holds the earlier input rows,
+// so the result matches an in-memory stable sort.
+func (s *recordStream) merge() error {
+	cmp := s.c.recordOrder()
+	runs := make([]*spillRun, len(s.runs))
+	for i, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("rewinding spill file: %w", err)
+		}
+		runs[i] = &spillRun{dec: json.NewDecoder(bufio.NewReader(f))}
+		if err := runs[i].advance(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var min *spillRun
+		for _, run := range runs {
+			if !run.done && (min == nil || cmp(run.next, min.next) < 0) {
+				min = run
+			}
+		}
+		if min == nil {
+			return nil
+		}
+		if err := s.write(min.next); err != nil {
+			return err
+		}
+		if err := min.advance(); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanup closes and removes the spill files.
+func (s *recordStream) cleanup() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+}
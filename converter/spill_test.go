@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSpillMergeSortsLikeMemory(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	dates := []string{"2023-01-05", "2023-01-02", "2023-01-04", "2023-01-02", "2023-01-01", "2023-01-04", "2023-01-03"}
+	var records []KoinlyRecord
+	for i, date := range dates {
+		records = append(records, KoinlyRecord{Date: date + " 00:00:00", ReceivedAmount: string(rune('a' + i)), ReceivedCurrency: "BTC", kind: "deposit"})
+	}
+
+	run := func(maxBuffer int) ([]KoinlyRecord, int) {
+		conv := New()
+		conv.OutputOrder = OrderDate
+		conv.MaxBuffer = maxBuffer
+		conv.resetOutput()
+
+		var out []KoinlyRecord
+		s := &recordStream{c: conv, emit: func(r KoinlyRecord) error {
+			out = append(out, r)
+			return nil
+		}}
+		defer s.cleanup()
+		for _, r := range records {
+			if err := s.add([]KoinlyRecord{r}); err != nil {
+				t.Fatalf("add failed: %v", err)
+			}
+		}
+		spilled := len(s.runs)
+		if err := s.close(); err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+		return out, spilled
+	}
+
+	want, _ := run(0)
+	got, spilled := run(2)
+	if spilled == 0 {
+		t.Fatal("Expected a buffer of 2 to spill")
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Date != want[i].Date || got[i].ReceivedAmount != want[i].ReceivedAmount || got[i].kind != want[i].kind {
+			t.Errorf("Record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Spill files left behind: %v", entries)
+	}
+}
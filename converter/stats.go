@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stats counts what the last conversion did with its input rows.
+type Stats struct {
+	Rows         int // data rows read
+	Deposits     int
+	Withdrawals  int
+	Trades       int // completed trades
+	Rewards      int
+	Interest     int // interest and lending payouts
+	Forks        int
+	Staking      int // staking locks and unlocks
+	Adjustments  int
+	Transfers    int // internal transfers, see InternalTransfers
+	Rejected     int // rows rejected by K33 or as invalid
+	Skipped      int // rows filtered out or with unusable fields
+	Unrecognized int // rows with an unhandled Type/Status
+	Duplicates   int // records dropped under Dedup
+}
+
+// Stats returns the counts of the last conversion.
+func (c *Converter) Stats() Stats {
+	return c.stats
+}
+
+// count tallies converted records by type. Fee lines and cost rows belong
+// to a withdrawal or trade already counted.
+func (s *Stats) count(records []KoinlyRecord) {
+	for _, r := range records {
+		switch {
+		case r.kind == "deposit":
+			s.Deposits++
+		case r.kind == "withdrawal" && !r.feeLine:
+			s.Withdrawals++
+		case r.kind == "trade" && r.Label != "cost":
+			s.Trades++
+		case r.kind == "reward":
+			s.Rewards++
+		case r.kind == "interest":
+			s.Interest++
+		case r.kind == "fork":
+			s.Forks++
+		case r.kind == "staking":
+			s.Staking++
+		case r.kind == "adjustment":
+			s.Adjustments++
+		}
+	}
+}
+
+// String summarises s on one line, leaving out counts that are zero.
+func (s Stats) String() string {
+	parts := []string{fmt.Sprintf("%d rows", s.Rows)}
+	for _, n := range []struct {
+		count int
+		name  string
+	}{
+		{s.Deposits, "deposits"},
+		{s.Withdrawals, "withdrawals"},
+		{s.Trades, "trades"},
+		{s.Rewards, "rewards"},
+		{s.Interest, "interest payouts"},
+		{s.Forks, "forks"},
+		{s.Staking, "staking moves"},
+		{s.Adjustments, "adjustments"},
+		{s.Transfers, "transfers"},
+		{s.Rejected, "rejected"},
+		{s.Skipped, "skipped"},
+		{s.Unrecognized, "unrecognized"},
+		{s.Duplicates, "duplicates dropped"},
+	} {
+		if n.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n.count, n.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,31 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100,,USD,2023/01/14 10:30:45
+Deposit Complete,,,n/a,,USD,2023/01/14 10:31:45
+Withdrawal Complete,,,-50,,USD,2023/01/14 10:32:45
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45
+Trade,2,Sell,-0.1,Reject,BTC,2023/01/15 10:31:45
+Staking Reward,,,0.01,,ETH,2023/01/16 10:30:45
+Airdrop Pending,,,5,,XYZ,2023/01/17 10:30:45`
+
+	conv := New()
+	if err := conv.Process(strings.NewReader(input), &strings.Builder{}); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	want := Stats{Rows: 8, Deposits: 1, Withdrawals: 1, Trades: 1, Rewards: 1, Rejected: 1, Skipped: 1, Unrecognized: 1}
+	if got := conv.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	if got, want := conv.Stats().String(), "8 rows, 1 deposits, 1 withdrawals, 1 trades, 1 rewards, 1 rejected, 1 skipped, 1 unrecognized"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
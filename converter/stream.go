@@ -0,0 +1,113 @@
+package converter
+
+import "os"
+
+// recordStream passes finalized records on to emit as rows are read.
+// Records that may still be joined with a later one (see holds) are held
+// until close instead, the way trade legs wait for their counterpart, so
+// a withdrawal and its fee line, or the two sides of an internal
+// transfer, are joined wherever K33 exports them.
+// Records after a held one are held behind it to keep the input order.
+// When records are sorted (see recordOrder) the order is only known at
+// the end, so records are buffered until close, spilling to temp files
+// past c.MaxBuffer.
+type recordStream struct {
+	c      *Converter
+	emit   func(KoinlyRecord) error
+	held   []KoinlyRecord
+	sorted []KoinlyRecord
+	runs   []*os.File
+}
+
+// holds reports whether r is held until the end of the input: a
+// withdrawal or withdrawal fee line with a reference id, which
+// attachWithdrawalFees may join with another, and under InternalTransfers
+// a deposit or withdrawal with a transferKey.
+func (c *Converter) holds(r KoinlyRecord) bool {
+	if r.kind == "withdrawal" && r.ref != "" {
+		return true
+	}
+	return c.InternalTransfers && (r.kind == "deposit" || r.kind == "withdrawal") && transferKey(r) != ""
+}
+
+// add passes on the records converted from a row, holding those that
+// may be joined later and any after them.
+func (s *recordStream) add(records []KoinlyRecord) error {
+	ready := make([]KoinlyRecord, 0, len(records))
+	for _, r := range records {
+		if len(s.held) > 0 || s.c.holds(r) {
+			s.held = append(s.held, r)
+			continue
+		}
+		ready = append(ready, r)
+	}
+	return s.pass(ready)
+}
+
+// flush joins and releases the held records.
+func (s *recordStream) flush() error {
+	c := s.c
+	records := c.attachWithdrawalFees(s.held)
+	if c.InternalTransfers {
+		records = c.mergeInternalTransfers(records)
+	}
+	s.held = nil
+	return s.pass(records)
+}
+
+// pass writes records, or buffers them when the output is sorted.
+func (s *recordStream) pass(records []KoinlyRecord) error {
+	c := s.c
+	for _, r := range records {
+		if c.DescLine {
+			appendLines(&r)
+		}
+		if !c.keepAsset(r) {
+			continue
+		}
+		if c.Dedup && c.duplicate(r) {
+			c.stats.Duplicates++
+			continue
+		}
+		c.checkCurrencies(r)
+		if c.recordOrder() != nil {
+			s.sorted = append(s.sorted, r)
+			if c.MaxBuffer > 0 && len(s.sorted) >= c.MaxBuffer {
+				if err := s.spill(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := s.write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close releases everything still held, in output order.
+func (s *recordStream) close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if len(s.runs) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+		return s.merge()
+	}
+	s.c.sortRecords(s.sorted)
+	for _, r := range s.sorted {
+		if err := s.write(r); err != nil {
+			return err
+		}
+	}
+	s.sorted = nil
+	return nil
+}
+
+func (s *recordStream) write(r KoinlyRecord) error {
+	s.c.observe(r)
+	return s.emit(r)
+}
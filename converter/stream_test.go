@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordsStreamBeforeEOF(t *testing.T) {
+	pr, pw := io.Pipe()
+	emitted := make(chan KoinlyRecord, 10)
+
+	go func() {
+		io.WriteString(pw, "Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)\n"+
+			"Deposit Complete,,,100,,USD,2023/01/14 10:30:45\n"+
+			"Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45\n")
+		// The deposit must be emitted while the input is still open
+		select {
+		case <-emitted:
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(io.ErrUnexpectedEOF)
+			return
+		}
+		io.WriteString(pw, "Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45\n")
+		pw.Close()
+	}()
+
+	var records []KoinlyRecord
+	err := New().convert([]io.Reader{pr}, nil, func(r KoinlyRecord) error {
+		records = append(records, r)
+		emitted <- r
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("convert failed (records not streamed?): %v", err)
+	}
+	if len(records) != 2 || records[0].ReceivedCurrency != "USD" || records[1].SentCurrency != "BTC" {
+		t.Errorf("Streamed records = %+v, want the deposit then the trade", records)
+	}
+}
+
+func TestProcessWritesHeaderOnlyForValidInput(t *testing.T) {
+	output := &strings.Builder{}
+	if err := New().Process(strings.NewReader("not,a,k33,header\n"), output); err == nil {
+		t.Fatal("Expected an error for an invalid header")
+	}
+	if output.Len() != 0 {
+		t.Errorf("Output written for invalid input: %q", output.String())
+	}
+}
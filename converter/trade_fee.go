@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isTradeFee reports whether k33 is a trade fee exported as its own row,
+// either a "Trade Fee" type or a Trade row with Side "Fee".
+func isTradeFee(k33 K33Record) bool {
+	if k33.TypeStatus == "Trade" {
+		return strings.EqualFold(k33.Side, "Fee")
+	}
+	return strings.Contains(k33.TypeStatus, "Trade") && strings.Contains(k33.TypeStatus, "Fee")
+}
+
+// tradeFee is a trade's total fee in one currency.
+type tradeFee struct {
+	amount   *big.Rat
+	currency string
+}
+
+// tradeFees totals a trade's fees per currency, in the order currencies
+// are first seen: the inline fees carried on the sell fills, then those on
+// the buy fills, then any separate fee rows. A fee without a currency is
+// given c.FeeCurrency's choice, by default the sell asset.
+func (c *Converter) tradeFees(trade *TradePair) []tradeFee {
+	var fees []tradeFee
+	add := func(amount, currency string) {
+		if amount == "" {
+			return
+		}
+		r, err := parseAmount(amount)
+		if err != nil {
+			return
+		}
+		r.Abs(r)
+		if currency == "" {
+			currency = c.defaultFeeCurrency(trade)
+		}
+		for i := range fees {
+			if fees[i].currency == currency {
+				fees[i].amount.Add(fees[i].amount, r)
+				return
+			}
+		}
+		fees = append(fees, tradeFee{amount: r, currency: currency})
+	}
+
+	for _, leg := range slices.Concat(trade.SellLegs, trade.BuyLegs) {
+		add(leg.Fee, leg.FeeCurrency)
+	}
+	for _, leg := range trade.FeeLegs {
+		if leg.Amount != "" {
+			add(leg.Amount, leg.Asset)
+		} else {
+			add(leg.Fee, leg.FeeCurrency)
+		}
+	}
+	return fees
+}
+
+// tradeLines lists the input lines of a trade's legs and fee rows in
+// ascending order. Legs loaded with LoadPending have no line and are left
+// out.
+func tradeLines(trade *TradePair) []int {
+	var lines []int
+	for _, leg := range slices.Concat(trade.SellLegs, trade.BuyLegs, trade.FeeLegs) {
+		if leg.line > 0 {
+			lines = append(lines, leg.line)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// feeRecords writes trade fees that do not fit on the trade's own row as
+// standalone cost rows, so no fee is dropped.
+func feeRecords(trade *TradePair, date string, at time.Time, fees []tradeFee) []KoinlyRecord {
+	records := make([]KoinlyRecord, 0, len(fees))
+	for _, fee := range fees {
+		records = append(records, KoinlyRecord{
+			Date:         date,
+			SentAmount:   formatAmount(fee.amount),
+			SentCurrency: fee.currency,
+			Label:        "cost",
+			Description:  fmt.Sprintf("Trade fee (K33) - %s", trade.TradeID),
+			kind:         "trade",
+			at:           at,
+		})
+	}
+	return records
+}
@@ -0,0 +1,115 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTradeFeeRowsAccumulate(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,0.001,BTC
+Trade Fee,1,,-0.0005,,BTC,2023/01/15 10:30:45,,
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45,,
+Trade,2,Fee,-3,Filled,NOK,2023/01/16 10:30:45,,
+Trade,2,Sell,-0.25,Filled,BTC,2023/01/16 10:30:45,,
+Trade,2,Buy,500,Filled,USD,2023/01/16 10:30:45,,
+Trade,3,Sell,-1,Filled,ETH,2023/01/17 10:30:45,0.5,USD
+Trade Fee,3,,-2,,NOK,2023/01/17 10:30:45,,
+Trade,3,Buy,200,Filled,USD,2023/01/17 10:30:45,,`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 3 trades and 1 extra fee row, got %d: %+v", len(records), records)
+	}
+
+	if r := records[0]; r.FeeAmount != "0.0015" || r.FeeCurrency != "BTC" {
+		t.Errorf("Trade 1 fee = %s %s, want inline and fee row summed to 0.0015 BTC", r.FeeAmount, r.FeeCurrency)
+	}
+	if r := records[1]; r.FeeAmount != "3" || r.FeeCurrency != "NOK" {
+		t.Errorf("Trade 2 fee = %s %s, want 3 NOK kept though neither leg is NOK", r.FeeAmount, r.FeeCurrency)
+	}
+	if r := records[2]; r.FeeAmount != "0.5" || r.FeeCurrency != "USD" {
+		t.Errorf("Trade 3 fee = %s %s, want 0.5 USD", r.FeeAmount, r.FeeCurrency)
+	}
+	if r := records[3]; r.SentAmount != "2" || r.SentCurrency != "NOK" || r.Label != "cost" || r.Date != records[2].Date {
+		t.Errorf("Second-currency fee row = %+v, want a 2 NOK cost row dated with trade 3", r)
+	}
+}
+
+func TestLateTradeFeeRowKept(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45
+Deposit Complete,,,5,,ETH,2023/01/15 10:31:45
+Trade Fee,1,,-0.0005,,BTC,2023/01/15 10:30:45`
+
+	conv := New()
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected trade, deposit and a cost row, got %d: %+v", len(records), records)
+	}
+	if r := records[2]; r.SentAmount != "0.0005" || r.SentCurrency != "BTC" || r.Label != "cost" {
+		t.Errorf("Late fee row = %+v, want a 0.0005 BTC cost row", r)
+	}
+	if len(conv.trades) != 0 {
+		t.Errorf("Fee-only trade left pending: %v", conv.trades)
+	}
+}
+
+func TestFeeRowsAcrossPartialFills(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45
+Trade,1,Buy,600,Filled,USD,2023/01/15 10:30:45
+Trade Fee,1,,-0.6,,USD,2023/01/15 10:30:45
+Trade,1,Buy,400,Filled,USD,2023/01/15 10:30:46
+Trade Fee,1,,-0.4,,USD,2023/01/15 10:30:46
+Trade Fee,1,,-5,,NOK,2023/01/15 10:30:46`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the trade and one extra fee row, got %d: %+v", len(records), records)
+	}
+
+	if r := records[0]; r.ReceivedAmount != "1000" || r.FeeAmount != "1" || r.FeeCurrency != "USD" {
+		t.Errorf("Trade = %s received, fee %s %s, want 1000 with the USD fee rows summed to 1", r.ReceivedAmount, r.FeeAmount, r.FeeCurrency)
+	}
+	if r := records[1]; r.SentAmount != "5" || r.SentCurrency != "NOK" || r.Label != "cost" {
+		t.Errorf("NOK fee row = %+v, want a separate 5 NOK cost row", r)
+	}
+}
+
+func TestInlineFeesOnBothLegs(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),Fee,Fee Currency
+Trade,1,Sell,-0.5,Filled,BTC,2023/01/15 10:30:45,0.001,BTC
+Trade,1,Buy,1000,Filled,USD,2023/01/15 10:30:45,2,USD`
+
+	conv := New()
+	var report strings.Builder
+	conv.FeeReport = &report
+	var out strings.Builder
+	if err := conv.Process(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want the trade and a cost row, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[1], "2023-01-15 10:30:45,0.5,BTC,1000,USD,0.001,BTC,") {
+		t.Errorf("trade row = %s, want the sell leg's BTC fee", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "2023-01-15 10:30:45,2,USD,,,,,,,cost,") {
+		t.Errorf("fee row = %s, want the buy leg's 2 USD fee as a cost row", lines[2])
+	}
+	if want := "Currency,Total Fee\nBTC,0.001\nUSD,2\n"; report.String() != want {
+		t.Errorf("fee report =\n%s\nwant\n%s", report.String(), want)
+	}
+}
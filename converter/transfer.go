@@ -0,0 +1,73 @@
+package converter
+
+// transferKey is what ties the two sides of an internal transfer: the K33
+// reference id, or without one the TxHash. It is empty for records with
+// neither.
+func transferKey(r KoinlyRecord) string {
+	if r.ref != "" {
+		return "ref:" + r.ref
+	}
+	if r.TxHash != "" {
+		return "tx:" + r.TxHash
+	}
+	return ""
+}
+
+// mergeInternalTransfers joins each withdrawal with a deposit sharing its
+// transferKey and currency into one row sending and receiving that
+// currency, which Koinly books as a move between the user's own wallets
+// rather than a disposal and an income. Like attachWithdrawalFees it is
+// given the records recordStream held until the end of the input, so the
+// two sides may settle at different times. A fee on both sides is summed
+// when the currencies match; otherwise the deposit's fee is dropped with a
+// warning.
+func (c *Converter) mergeInternalTransfers(records []KoinlyRecord) []KoinlyRecord {
+	withdrawals := make(map[[2]string]int)
+	for i, r := range records {
+		if r.kind == "withdrawal" && !r.feeLine && r.Label == "" {
+			if key := transferKey(r); key != "" {
+				withdrawals[[2]string{key, r.SentCurrency}] = i
+			}
+		}
+	}
+	if len(withdrawals) == 0 {
+		return records
+	}
+
+	merged := make(map[int]bool)
+	for j, r := range records {
+		if r.kind != "deposit" || r.Label != "" {
+			continue
+		}
+		key := [2]string{transferKey(r), r.ReceivedCurrency}
+		i, ok := withdrawals[key]
+		if !ok || key[0] == "" {
+			continue
+		}
+		delete(withdrawals, key)
+
+		w := &records[i]
+		w.ReceivedAmount, w.ReceivedCurrency = r.ReceivedAmount, r.ReceivedCurrency
+		if r.FeeAmount != "" && !attachFee(w, KoinlyRecord{SentAmount: r.FeeAmount, SentCurrency: r.FeeCurrency}) {
+			c.warnf("Internal transfer %s keeps its withdrawal fee %s %s and drops the deposit fee %s %s",
+				key[0], w.FeeAmount, w.FeeCurrency, r.FeeAmount, r.FeeCurrency)
+		}
+		w.Description = c.describe("transfer", "Internal transfer (K33)", descriptionVars{asset: w.SentCurrency})
+		c.truncateDescription(w)
+		w.kind = "transfer"
+		// Both rows were counted when read
+		c.stats.Deposits--
+		c.stats.Withdrawals--
+		c.stats.Transfers++
+		w.lines = append(w.lines, r.lines...)
+		merged[j] = true
+	}
+
+	kept := make([]KoinlyRecord, 0, len(records)-len(merged))
+	for j, r := range records {
+		if !merged[j] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestInternalTransfers(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC),InternalReportID,DepositTxhash,WithdrawalTxhash
+Withdrawal Complete,-0.5,BTC,2023/01/15 10:30:45,77,,
+Withdrawal Fee,-0.0001,BTC,2023/01/15 10:30:45,77,,
+Deposit Complete,0.5,BTC,2023/01/15 10:30:45,77,,
+Withdrawal Complete,-2,ETH,2023/01/16 10:30:45,,,0xabc
+Deposit Complete,2,ETH,2023/01/16 10:30:45,,0xabc,
+Withdrawal Complete,-100,USD,2023/01/17 10:30:45,78,,
+Deposit Complete,100,EUR,2023/01/17 10:30:45,78,,`
+
+	convert := func(merge bool) []KoinlyRecord {
+		conv := New()
+		conv.InternalTransfers = merge
+		var records []KoinlyRecord
+		if err := conv.convert([]io.Reader{strings.NewReader(input)}, nil, func(r KoinlyRecord) error {
+			records = append(records, r)
+			return nil
+		}); err != nil {
+			t.Fatalf("convert failed: %v", err)
+		}
+		return records
+	}
+
+	if records := convert(false); len(records) != 6 {
+		t.Errorf("without InternalTransfers want 6 records, got %+v", records)
+	}
+
+	records := convert(true)
+	if len(records) != 4 {
+		t.Fatalf("want 4 records, got %+v", records)
+	}
+	for i, want := range []struct{ sent, received, currency, fee string }{
+		{"0.5", "0.5", "BTC", "0.0001"},
+		{"2", "2", "ETH", ""},
+	} {
+		r := records[i]
+		if r.SentAmount != want.sent || r.ReceivedAmount != want.received ||
+			r.SentCurrency != want.currency || r.ReceivedCurrency != want.currency || r.FeeAmount != want.fee {
+			t.Errorf("transfer %d = %+v, want %s sent and %s received in %s with fee %q", i, r, want.sent, want.received, want.currency, want.fee)
+		}
+		if r.Label != "" || r.Description != "Internal transfer (K33)" {
+			t.Errorf("transfer %d label = %q, description = %q", i, r.Label, r.Description)
+		}
+	}
+	// Different currencies are not a transfer
+	if records[2].SentCurrency != "USD" || records[3].ReceivedCurrency != "EUR" {
+		t.Errorf("want the USD withdrawal and EUR deposit kept apart, got %+v", records[2:])
+	}
+}
+
+func TestInternalTransferKind(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC),InternalReportID
+Withdrawal Complete,-0.5,BTC,2023/01/15 10:30:45,77
+Deposit Complete,0.5,BTC,2023/01/15 10:30:45,77
+Withdrawal Complete,-100,USD,2023/01/14 10:30:45,
+Deposit Complete,100,USD,2023/01/16 10:30:45,`
+
+	conv := New()
+	conv.InternalTransfers = true
+	conv.Target = TargetCoinTracking
+	conv.OutputOrder = OrderType
+	var out strings.Builder
+	if err := conv.Process(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	for i, prefix := range []string{"Deposit,100,USD,", "Transfer,0.5,BTC,0.5,BTC,", "Withdrawal,,,100,USD,"} {
+		if i >= len(lines) || !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("row %d = %q, want prefix %s, in:\n%s", i, lines[min(i, len(lines)-1)], prefix, out.String())
+		}
+	}
+	if got, want := conv.Stats().String(), "4 rows, 1 deposits, 1 withdrawals, 1 transfers"; got != want {
+		t.Errorf("Stats = %q, want %q", got, want)
+	}
+}
+
+func TestInternalTransferApart(t *testing.T) {
+	input := `Type/Status,Amount,Gross Amount,Net Amount,Asset,Timestamp (UTC),InternalReportID
+Deposit Complete,0.4999,0.5,0.4999,BTC,2023/01/15 11:02:00,77
+Deposit Complete,100,,,USD,2023/01/15 10:45:00,
+Withdrawal Complete,-0.5,,,BTC,2023/01/15 10:30:45,77
+Withdrawal Fee,-0.0002,,,BTC,2023/01/15 10:30:45,77`
+
+	conv := New()
+	conv.InternalTransfers = true
+	var records []KoinlyRecord
+	if err := conv.convert([]io.Reader{strings.NewReader(input)}, nil, func(r KoinlyRecord) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("convert failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("want the USD deposit and one transfer, got %+v", records)
+	}
+	if r := records[0]; r.ReceivedCurrency != "USD" || r.SentCurrency != "" {
+		t.Errorf("record 0 = %+v, want the USD deposit", r)
+	}
+	r := records[1]
+	if r.kind != "transfer" || r.SentAmount != "0.5" || r.ReceivedAmount != "0.4999" || r.FeeAmount != "0.0003" || r.FeeCurrency != "BTC" {
+		t.Errorf("transfer = %+v, want 0.5 BTC sent, 0.4999 received, fees summed to 0.0003 BTC", r)
+	}
+}
@@ -0,0 +1,232 @@
+package converter
+
+import (
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Transform rewrites a single output cell value.
+type Transform func(string) string
+
+// transformFuncs are the functions available to transform expressions.
+// Each takes its literal arguments and returns the cell transform; none of
+// them perform any IO.
+var transformFuncs = map[string]func(args []string) (Transform, error){
+	"upper": noArgs(strings.ToUpper),
+	"lower": noArgs(strings.ToLower),
+	"trim":  noArgs(strings.TrimSpace),
+	"prefix": func(args []string) (Transform, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("prefix takes 1 argument")
+		}
+		return func(v string) string { return args[0] + v }, nil
+	},
+	"suffix": func(args []string) (Transform, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("suffix takes 1 argument")
+		}
+		return func(v string) string { return v + args[0] }, nil
+	},
+	"replace": func(args []string) (Transform, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("replace takes 2 arguments")
+		}
+		return func(v string) string { return strings.ReplaceAll(v, args[0], args[1]) }, nil
+	},
+	"default": func(args []string) (Transform, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("default takes 1 argument")
+		}
+		return func(v string) string {
+			if v == "" {
+				return args[0]
+			}
+			return v
+		}, nil
+	},
+	"round": func(args []string) (Transform, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("round takes 1 argument")
+		}
+		places, err := strconv.Atoi(args[0])
+		if err != nil || places < 0 {
+			return nil, fmt.Errorf("round: invalid decimal places %q", args[0])
+		}
+		return func(v string) string {
+			r, ok := new(big.Rat).SetString(v)
+			if v == "" || !ok {
+				return v
+			}
+			return r.FloatString(places)
+		}, nil
+	},
+}
+
+func noArgs(fn func(string) string) func([]string) (Transform, error) {
+	return func(args []string) (Transform, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("takes no arguments")
+		}
+		return fn, nil
+	}
+}
+
+// ParseTransform compiles a transform expression: a "|"-separated pipeline
+// of function calls applied left to right, such as
+//
+//	trim | upper
+//	replace("-", "") | default("0")
+//
+// Arguments are double-quoted strings or bare numbers.
+func ParseTransform(expr string) (Transform, error) {
+	p := &exprParser{src: expr}
+	var steps []Transform
+	for {
+		step, err := p.call()
+		if err != nil {
+			return nil, fmt.Errorf("transform %q: %w", expr, err)
+		}
+		steps = append(steps, step)
+
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if !p.consume('|') {
+			return nil, fmt.Errorf("transform %q: expected | at offset %d", expr, p.pos)
+		}
+	}
+
+	return func(v string) string {
+		for _, step := range steps {
+			v = step(v)
+		}
+		return v
+	}, nil
+}
+
+// ParseColumnTransform parses a "Column=expression" spec such as
+// "Sent Currency=upper", checking the column against the output headers.
+func ParseColumnTransform(spec string) (string, Transform, error) {
+	column, expr, ok := strings.Cut(spec, "=")
+	if !ok {
+		return "", nil, fmt.Errorf("transform %q: want Column=expression", spec)
+	}
+	column = strings.TrimSpace(column)
+	if !isOutputColumn(column) {
+		return "", nil, fmt.Errorf("transform %q: unknown output column %q", spec, column)
+	}
+	transform, err := ParseTransform(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	return column, transform, nil
+}
+
+// CheckTransforms reports an error for a Transforms column missing from
+// the configured output header, e.g. "Sent Currency" under
+// TargetCoinTracking, since its transform would never apply.
+func (c *Converter) CheckTransforms() error {
+	header := c.outputHeader()
+	columns := slices.Sorted(maps.Keys(c.Transforms))
+	for _, col := range columns {
+		if !slices.Contains(header, col) {
+			return fmt.Errorf("transform column %q is not written by the %s target", col, c.Target)
+		}
+	}
+	return nil
+}
+
+// exprParser is a small recursive-descent parser over a transform expression.
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) done() bool { return p.pos >= len(p.src) }
+
+func (p *exprParser) skipSpace() {
+	for !p.done() && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) consume(ch byte) bool {
+	p.skipSpace()
+	if !p.done() && p.src[p.pos] == ch {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) call() (Transform, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.done() && (unicode.IsLetter(rune(p.src[p.pos])) || p.src[p.pos] == '_') {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("expected function name at offset %d", start)
+	}
+	fn, ok := transformFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+
+	var args []string
+	if p.consume('(') {
+		for !p.consume(')') {
+			if len(args) > 0 && !p.consume(',') {
+				return nil, fmt.Errorf("expected , or ) at offset %d", p.pos)
+			}
+			arg, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+	}
+
+	t, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+func (p *exprParser) literal() (string, error) {
+	p.skipSpace()
+	if p.done() {
+		return "", fmt.Errorf("unexpected end of expression")
+	}
+
+	if p.src[p.pos] == '"' {
+		start := p.pos
+		for p.pos++; !p.done(); p.pos++ {
+			switch p.src[p.pos] {
+			case '\\':
+				p.pos++
+			case '"':
+				p.pos++
+				return strconv.Unquote(p.src[start:p.pos])
+			}
+		}
+		return "", fmt.Errorf("unterminated string at offset %d", start)
+	}
+
+	start := p.pos
+	for !p.done() && strings.ContainsRune("+-.0123456789", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", fmt.Errorf("expected literal at offset %d", start)
+	}
+	return p.src[start:p.pos], nil
+}
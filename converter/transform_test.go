@@ -0,0 +1,102 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		expr     string
+		input    string
+		expected string
+	}{
+		{"upper", "btc", "BTC"},
+		{" trim | lower ", "  ETH ", "eth"},
+		{`prefix("x") | suffix("!")`, "a", "xa!"},
+		{`replace("-", "")`, "2023-01-15", "20230115"},
+		{`default("0")`, "", "0"},
+		{"round(2)", "1000.456", "1000.46"},
+		{"round(2)", "", ""},
+	}
+
+	for _, test := range tests {
+		transform, err := ParseTransform(test.expr)
+		if err != nil {
+			t.Errorf("ParseTransform(%s) returned error: %v", test.expr, err)
+			continue
+		}
+		if result := transform(test.input); result != test.expected {
+			t.Errorf("%s(%q) = %q, want %q", test.expr, test.input, result, test.expected)
+		}
+	}
+
+	for _, expr := range []string{"", "exec", "upper(1)", "upper |", `prefix("x`, "round(a)"} {
+		if _, err := ParseTransform(expr); err == nil {
+			t.Errorf("ParseTransform(%q) expected error", expr)
+		}
+	}
+}
+
+func TestColumnTransforms(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Trade,1,Sell,-0.5,Filled,btc,2023/01/15 10:30:45
+Trade,1,Buy,1000,Filled,usd,2023/01/15 10:30:45`
+
+	upper, err := ParseTransform("upper")
+	if err != nil {
+		t.Fatalf("ParseTransform failed: %v", err)
+	}
+	conv := New()
+	conv.Transforms = map[string]Transform{
+		"Sent Currency":     upper,
+		"Received Currency": upper,
+	}
+
+	output := &strings.Builder{}
+	if err := conv.Process(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	expected := "2023-01-15 10:30:45,0.5,BTC,1000,USD,,,,,,Trade (K33) - 1,"
+	if len(lines) != 2 || lines[1] != expected {
+		t.Errorf("Transformed row = %q, want %q", lines[len(lines)-1], expected)
+	}
+}
+
+func TestParseColumnTransform(t *testing.T) {
+	column, transform, err := ParseColumnTransform("Fee Currency=lower")
+	if err != nil {
+		t.Fatalf("ParseColumnTransform failed: %v", err)
+	}
+	if column != "Fee Currency" || transform("BTC") != "btc" {
+		t.Errorf("ParseColumnTransform = %q, transform(BTC) = %q", column, transform("BTC"))
+	}
+
+	for _, spec := range []string{"upper", "Currency=upper", "Sent Currency=nope"} {
+		if _, _, err := ParseColumnTransform(spec); err == nil {
+			t.Errorf("ParseColumnTransform(%q) expected error", spec)
+		}
+	}
+}
+
+func TestCheckTransforms(t *testing.T) {
+	conv := New()
+	conv.Transforms = map[string]Transform{"Sent Currency": strings.ToUpper}
+	if err := conv.CheckTransforms(); err != nil {
+		t.Errorf("CheckTransforms = %v, want nil for a Koinly column", err)
+	}
+	conv.Target = TargetCoinTracking
+	if err := conv.CheckTransforms(); err == nil || !strings.Contains(err.Error(), `"Sent Currency"`) {
+		t.Errorf("CheckTransforms = %v, want an error for a Koinly column under CoinTracking", err)
+	}
+	conv.Transforms = map[string]Transform{"Tag": strings.ToUpper}
+	if err := conv.CheckTransforms(); err == nil {
+		t.Error("CheckTransforms accepted Tag without a Tag column")
+	}
+	conv.Tag = "core"
+	if err := conv.CheckTransforms(); err != nil {
+		t.Errorf("CheckTransforms = %v, want nil for Tag when tagging", err)
+	}
+}
@@ -0,0 +1,54 @@
+package converter
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ParseUnitDivisor parses an ASSET:DIVISOR spec, e.g. "BTC:100000000" for
+// an export giving BTC amounts in satoshis.
+func ParseUnitDivisor(spec string) (string, *big.Rat, error) {
+	asset, divisor, found := strings.Cut(spec, ":")
+	asset = strings.ToUpper(strings.TrimSpace(asset))
+	if !found || asset == "" {
+		return "", nil, fmt.Errorf("unit divisor %q: want ASSET:DIVISOR", spec)
+	}
+	d, err := parseAmount(divisor)
+	if err != nil {
+		return "", nil, fmt.Errorf("unit divisor %q: %w", spec, err)
+	}
+	if d.Sign() <= 0 {
+		return "", nil, fmt.Errorf("unit divisor %q: must be positive", spec)
+	}
+	return asset, d, nil
+}
+
+// applyUnitDivisors converts a row's amounts from the smallest unit to
+// whole coins per c.UnitDivisors. Fees use their own currency, defaulting
+// to the row's asset.
+func (c *Converter) applyUnitDivisors(k33 *K33Record) {
+	if len(c.UnitDivisors) == 0 {
+		return
+	}
+	divide := func(amount *string, asset string) {
+		d, ok := c.UnitDivisors[strings.ToUpper(asset)]
+		if !ok || *amount == "" {
+			return
+		}
+		r, err := parseAmount(*amount)
+		if err != nil {
+			return
+		}
+		*amount = formatAmount(r.Quo(r, d))
+	}
+
+	divide(&k33.Amount, k33.Asset)
+	divide(&k33.GrossAmount, k33.Asset)
+	divide(&k33.NetAmount, k33.Asset)
+	feeCurrency := k33.FeeCurrency
+	if feeCurrency == "" {
+		feeCurrency = k33.Asset
+	}
+	divide(&k33.Fee, feeCurrency)
+}
@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestUnitDivisors(t *testing.T) {
+	input := `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC)
+Deposit Complete,,,100000000,,BTC,2023/01/15 10:30:45
+Withdrawal Complete,,,-1500000000000000000,,ETH,2023/01/16 10:30:45
+Deposit Complete,,,250,,USD,2023/01/17 10:30:45`
+
+	conv := New()
+	conv.UnitDivisors = map[string]*big.Rat{}
+	for _, spec := range []string{"BTC:100000000", "eth:1e18"} {
+		asset, divisor, err := ParseUnitDivisor(spec)
+		if err != nil {
+			t.Fatalf("ParseUnitDivisor(%q) failed: %v", spec, err)
+		}
+		conv.UnitDivisors[asset] = divisor
+	}
+
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if r := records[0]; r.ReceivedAmount != "1" || r.ReceivedCurrency != "BTC" {
+		t.Errorf("Satoshi deposit = %s %s, want 1 BTC", r.ReceivedAmount, r.ReceivedCurrency)
+	}
+	if r := records[1]; r.SentAmount != "1.5" || r.SentCurrency != "ETH" {
+		t.Errorf("Wei withdrawal = %s %s, want 1.5 ETH", r.SentAmount, r.SentCurrency)
+	}
+	if r := records[2]; r.ReceivedAmount != "250" {
+		t.Errorf("Asset without a divisor changed: %s", r.ReceivedAmount)
+	}
+
+	for _, spec := range []string{"BTC", "BTC:0", ":10", "BTC:x"} {
+		if _, _, err := ParseUnitDivisor(spec); err == nil {
+			t.Errorf("ParseUnitDivisor(%q) expected error", spec)
+		}
+	}
+}
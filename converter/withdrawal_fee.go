@@ -0,0 +1,87 @@
+package converter
+
+import "strings"
+
+// isWithdrawalFee reports whether typeStatus is the network fee line K33
+// exports alongside a withdrawal, e.g. "Withdrawal Fee".
+func isWithdrawalFee(typeStatus string) bool {
+	return strings.Contains(typeStatus, "Withdrawal") && strings.Contains(typeStatus, "Fee")
+}
+
+// createWithdrawalFeeRecord maps a withdrawal fee line to a standalone cost
+// row. attachWithdrawalFees folds it into its withdrawal when one shares
+// its reference id.
+func (c *Converter) createWithdrawalFeeRecord(k33 K33Record, timestamp string) KoinlyRecord {
+	amount := strings.TrimPrefix(k33.Amount, "-")
+
+	return KoinlyRecord{
+		Date:         timestamp,
+		SentAmount:   amount,
+		SentCurrency: k33.Asset,
+		Label:        "cost",
+		Description:  c.describe("withdrawal", "Withdrawal fee (K33)", rowVars(k33)),
+		kind:         "withdrawal",
+		TxHash:       k33.WithdrawalTxhash,
+		ref:          k33.ReferenceID,
+		feeLine:      true,
+	}
+}
+
+// attachWithdrawalFees moves each withdrawal fee line onto the withdrawal
+// sharing its reference id, the way trade fees ride on their trade. It is
+// given the records recordStream held until the end of the input, so the
+// two lines may be exported anywhere in it. Fee lines in the withdrawal's
+// currency are summed; lines without a matching withdrawal, or in a
+// different currency than a fee already attached, stay standalone rows.
+func (c *Converter) attachWithdrawalFees(records []KoinlyRecord) []KoinlyRecord {
+	withdrawals := make(map[string]int)
+	for i, r := range records {
+		if r.ref != "" && r.kind == "withdrawal" && !r.feeLine {
+			withdrawals[r.ref] = i
+		}
+	}
+	if len(withdrawals) == 0 {
+		return records
+	}
+
+	attached := make(map[int]bool)
+	for j, r := range records {
+		if !r.feeLine {
+			continue
+		}
+		if i, ok := withdrawals[r.ref]; ok && attachFee(&records[i], r) {
+			c.applyMinFee(&records[i])
+			records[i].lines = append(records[i].lines, r.lines...)
+			attached[j] = true
+		}
+	}
+
+	kept := make([]KoinlyRecord, 0, len(records)-len(attached))
+	for j, r := range records {
+		if !attached[j] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// attachFee adds a fee line's amount to w's fee, reporting whether it could.
+func attachFee(w *KoinlyRecord, fee KoinlyRecord) bool {
+	if w.FeeAmount == "" {
+		w.FeeAmount, w.FeeCurrency = fee.SentAmount, fee.SentCurrency
+		return true
+	}
+	if w.FeeCurrency != fee.SentCurrency {
+		return false
+	}
+	total, err := parseAmount(w.FeeAmount)
+	if err != nil {
+		return false
+	}
+	amount, err := parseAmount(fee.SentAmount)
+	if err != nil {
+		return false
+	}
+	w.FeeAmount = formatAmount(total.Add(total, amount))
+	return true
+}
@@ -0,0 +1,56 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithdrawalFeeLineAttached(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC),InternalReportID
+Withdrawal Fee,-0.0005,BTC,2023/01/15 10:30:45,2001
+Withdrawal Complete,-0.5,BTC,2023/01/15 10:30:45,2001
+Withdrawal Fee,-0.0001,BTC,2023/01/16 10:30:45,2002`
+
+	records, err := New().parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected withdrawal plus one orphan fee row, got %d: %+v", len(records), records)
+	}
+
+	w := records[0]
+	if w.SentAmount != "0.5" || w.FeeAmount != "0.0005" || w.FeeCurrency != "BTC" {
+		t.Errorf("Withdrawal = sent %s, fee %s %s; want 0.5 with fee 0.0005 BTC", w.SentAmount, w.FeeAmount, w.FeeCurrency)
+	}
+	if orphan := records[1]; orphan.SentAmount != "0.0001" || orphan.Label != "cost" {
+		t.Errorf("Orphan fee row = %+v, want a 0.0001 BTC cost row", orphan)
+	}
+}
+
+func TestWithdrawalFeeLineApart(t *testing.T) {
+	input := `Type/Status,Amount,Asset,Timestamp (UTC),InternalReportID
+Withdrawal Complete,-0.5,BTC,2023/01/15 10:30:45,2001
+Deposit Complete,100,USD,2023/01/15 11:00:00,
+Withdrawal Fee,-0.0005,BTC,2023/01/15 10:31:02,2001
+Withdrawal Fee,-0.0001,BTC,2023/01/16 10:30:45,2002`
+
+	conv := New()
+	conv.Descriptions = map[string]string{"withdrawal": "K33 {asset} out"}
+	records, err := conv.parseRecords(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected withdrawal, deposit and orphan fee row, got %d: %+v", len(records), records)
+	}
+	if w := records[0]; w.SentAmount != "0.5" || w.FeeAmount != "0.0005" || w.FeeCurrency != "BTC" {
+		t.Errorf("Withdrawal = sent %s, fee %s %s; want 0.5 with fee 0.0005 BTC", w.SentAmount, w.FeeAmount, w.FeeCurrency)
+	}
+	if r := records[1]; r.ReceivedCurrency != "USD" {
+		t.Errorf("Record 1 = %+v, want the deposit kept in input order", r)
+	}
+	if orphan := records[2]; orphan.SentAmount != "0.0001" || orphan.Description != "K33 BTC out" {
+		t.Errorf("Orphan fee row = %+v, want 0.0001 BTC described by the withdrawal template", orphan)
+	}
+}
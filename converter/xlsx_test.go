@@ -0,0 +1,90 @@
+package converter
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestXLSX writes a minimal workbook with one sheet to a temp file.
+func writeTestXLSX(t *testing.T, parts map[string]string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "k33.xlsx")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestReadXLSX(t *testing.T) {
+	filename := writeTestXLSX(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/export.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Type/Status</t></si><si><t>TradeID</t></si><si><t>Side</t></si><si><t>Amount</t></si>
+<si><t>Asset</t></si><si><r><t>Timestamp</t></r><r><t> (UTC)</t></r></si>
+<si><t>Trade</t></si><si><t>Sell</t></si><si><t>Buy</t></si><si><t>2023/01/15 10:30:45</t></si></sst>`,
+		"xl/worksheets/export.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c><c r="E1" t="s"><v>4</v></c><c r="F1" t="s"><v>5</v></c></row>
+<row r="2"><c r="A2" t="s"><v>6</v></c><c r="B2"><v>1.000000012345E12</v></c><c r="C2" t="s"><v>7</v></c><c r="D2"><v>-0.5</v></c><c r="E2" t="inlineStr"><is><t>BTC</t></is></c><c r="F2" t="s"><v>9</v></c></row>
+<row r="3"><c r="A3" t="s"><v>6</v></c><c r="B3"><v>1.000000012345E12</v></c><c r="C3" t="s"><v>8</v></c><c r="D3"><v>1000</v></c><c r="E3" t="inlineStr"><is><t>USD</t></is></c><c r="F3" t="s"><v>9</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	in, err := ReadXLSX(filename)
+	if err != nil {
+		t.Fatalf("ReadXLSX failed: %v", err)
+	}
+	output := &strings.Builder{}
+	if err := New().Process(in, output); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected header + 1 trade, got %d lines:\n%s", len(lines), output.String())
+	}
+	expected := "2023-01-15 10:30:45,0.5,BTC,1000,USD,,,,,,Trade (K33) - 1000000012345,"
+	if lines[1] != expected {
+		t.Errorf("Trade row = %q, want %q", lines[1], expected)
+	}
+}
+
+func TestReadXLSXSkippedCells(t *testing.T) {
+	filename := writeTestXLSX(t, map[string]string{
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>a</t></is></c><c r="C1" t="inlineStr"><is><t>c</t></is></c></row>
+</sheetData></worksheet>`,
+	})
+
+	in, err := ReadXLSX(filename)
+	if err != nil {
+		t.Fatalf("ReadXLSX failed: %v", err)
+	}
+	data, _ := io.ReadAll(in)
+	if string(data) != "a,,c\n" {
+		t.Errorf("CSV = %q, want %q", data, "a,,c\n")
+	}
+}
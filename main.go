@@ -1,43 +1,712 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"math/big"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"k33-to-koinly/converter"
 )
 
 func main() {
-	inPath := flag.String("in", "k33.csv", "K33 export CSV file")
-	outPath := flag.String("out", "koinly.csv", "Koinly universal CSV output")
+	os.Exit(run())
+}
+
+// run converts as the flags say and returns the exit status: 0 on success,
+// or 2 when the conversion raised warnings, unless -no-fail-on-warn. Hard
+// errors exit with status 1 through log.Fatal.
+func run() int {
+	inPath := flag.String("in", "k33.csv", "K33 export CSV or .xlsx file (- for stdin); a comma-separated list or glob converts several files in order")
+	outPath := flag.String("out", "koinly.csv", "Koinly universal CSV output (- for stdout, .gz to compress)")
+	manifest := flag.Bool("manifest", false, "Write a JSON manifest (SHA-256, rows, date range, parameters) next to the output")
+	gzipOut := flag.Bool("gzip-out", false, "Gzip-compress the output even without a .gz extension")
 	dryrun := flag.Bool("dryrun", false, "Print mapped rows without writing file")
+	teeJSON := flag.Bool("tee-json", false, "Also write each record as NDJSON to stdout (stderr when -out is -)")
+	strictDeposits := flag.Bool("strict-deposit-status", false, "Only import deposits with a final status (e.g. Complete)")
+	from := flag.String("from", "", "Only convert rows dated on or after this date (YYYY-MM-DD)")
+	to := flag.String("to", "", "Only convert rows dated on or before this date (YYYY-MM-DD)")
+	since := flag.String("since", "", "Only convert rows within this duration of now (e.g. 90d, 720h)")
+	zeroLegPolicy := flag.String("zero-leg-policy", "emit", "Trades with a zero-amount leg: emit, skip, or transfer")
+	signConvention := flag.String("sign-convention", "opposite", "Trade leg signs in the export: opposite (sell negative), negative (both), or any")
+	amountBasis := flag.String("amount-basis", "net", "Amount reported for deposits and withdrawals with Gross/Net Amount columns: net or gross")
+	tradeTime := flag.String("trade-time", "latest", "Leg whose timestamp dates a trade: first, buy, sell, earliest, or latest")
+	force := flag.Bool("force", false, "Overwrite an existing output file without asking")
+	noDeposits := flag.Bool("no-deposits", false, "Skip all deposit rows")
+	noWithdrawals := flag.Bool("no-withdrawals", false, "Skip all withdrawal rows")
+	noTrades := flag.Bool("no-trades", false, "Skip all trade rows")
+	skipLines := flag.Int("skip-lines", 0, "Skip this many lines before the K33 header")
+	humanOut := flag.String("human-out", "", "Also write a readable CSV with currency symbols (e.g. $1000) to this file")
+	feeReport := flag.String("fee-report", "", "Write total fees per currency as CSV to this file (- for stdout)")
+	dailySummary := flag.String("daily-summary", "", "Write amounts received, sent and paid in fees per day and asset as CSV to this file (- for stdout)")
+	zeroFill := flag.Bool("zero-fill-amounts", false, "Write 0 instead of empty Sent/Received/Fee amounts")
+	baseFiat := flag.String("map-fiat-to-base", "", "Convert all fiat amounts into this currency, using the -fiat-rates file")
+	fiatRatesPath := flag.String("fiat-rates", "", "Fiat rate CSV (date,from,rate) for -map-fiat-to-base")
+	pricesPath := flag.String("prices", "", "Price CSV (date,asset,currency,price) used to rebuild missing trade quote legs")
+	noFailOnWarn := flag.Bool("no-fail-on-warn", false, "Exit 0 even when the conversion raised warnings, instead of 2")
+	strict := flag.Bool("strict", false, "Fail if any trade is left unpaired")
+	explainUnpaired := flag.Bool("explain-unpaired", false, "Print the present leg of each unpaired trade to stderr at end of run")
+	verboseStats := flag.Bool("verbose-stats", false, "Print count, min, median and max amount per asset to stderr")
+	rejectsReport := flag.String("rejects", "", "Write the input rows left out of the output, with a Reason column, to this file")
+	unrecognizedReport := flag.String("report-unrecognized", "", "Write unhandled Type/Status values with a sample row to this file")
+	format := flag.String("format", "csv", "Output encoding: csv or jsonl (one JSON record per line)")
+	target := flag.String("target", "koinly", "CSV layout: koinly or cointracking")
+	inDelim := flag.String("in-delim", ",", `Input field delimiter: one character, or \t for tab`)
+	outDelim := flag.String("out-delim", ",", `Output field delimiter: one character, or \t for tab`)
+	verbose := flag.Bool("v", false, "Verbose: also log progress and informational notes")
+	quiet := flag.Bool("q", false, "Quiet: log nothing but errors")
+	bom := flag.Bool("bom", false, "Start the output with a UTF-8 BOM, for opening it in Excel (Koinly does not want one)")
+	withSeq := flag.Bool("with-seq", false, "Add a leading Seq column numbering rows in output order")
+	outputOrder := flag.String("output-order", "input", "Record order: input, date, or type (deposits, trades, transfers, withdrawals)")
+	maxErrors := flag.Int("max-errors", -1, "Skip up to N bad rows (malformed, invalid or rejected) and fail past that; -1 fails only on malformed rows")
+	internalTransfers := flag.Bool("internal-transfers", false, "Merge a withdrawal and deposit sharing a reference id or tx hash into one transfer row")
+	dedup := flag.Bool("dedup", false, "Drop records identical to one already written (by TxHash when present), e.g. from overlapping exports")
+	sortByDate := flag.Bool("sort", false, "Sort records by date before writing, keeping input order within a timestamp (same as -output-order date)")
+	reverse := flag.Bool("reverse", false, "Write newest dates first (sorts by date unless -output-order is set)")
+	maxBuffer := flag.Int("max-buffer", 0, "Spill sorted records to temp files past this many in memory (0 for no cap)")
+	tz := flag.String("tz", "", "Write dates in this time zone (e.g. Europe/Oslo) instead of UTC")
+	daily := flag.Bool("daily", false, "Truncate output timestamps to midnight")
+	offset := flag.Int64("offset", 0, "Resume at the first record at or after this byte offset")
+	assertColumns := flag.String("assert-columns", "", "Fail unless the header exactly matches this K33 schema version (or latest)")
+	tag := flag.String("tag", "", "Add a Tag column with this value on every row")
+	var assetTags stringList
+	flag.Var(&assetTags, "tag-asset", "Tag rows involving ASSET, as ASSET=TAG (repeatable)")
+	pendingIn := flag.String("pending-in", "", "Load unpaired trade legs saved by a previous run's -pending-out")
+	pendingOut := flag.String("pending-out", "", "Save trade legs left unpaired to this file for a later run")
+	noTrim := flag.Bool("no-trim", false, "Keep whitespace around data cells instead of trimming it")
+	noColor := flag.Bool("no-color", false, "Disable colored dry-run output")
+	var columns stringList
+	fiatValueColumn := flag.String("fiat-value-column", "Fiat Value", "Export column with the fiat value of each row, used for trade net worth")
+	fiatValueCurrency := flag.String("fiat-value-currency", "USD", "Currency of fiat values that do not name one")
+	flag.Var(&columns, "column", "Map an export column to a K33 column, as K33NAME=EXPORTNAME (repeatable)")
+	var directionValues stringList
+	var rejectStatuses stringList
+	var fiat stringList
+	flag.Var(&fiat, "fiat", "Also treat this currency code as fiat (repeatable)")
+	inferTypeFromSign := flag.Bool("infer-type-from-sign", false, "Treat rows without a Type/Status as deposits (positive amount) or withdrawals (negative)")
+	flag.Var(&directionValues, "direction-value", "Treat a Direction column value as in or out, as VALUE=in|out (repeatable)")
+	flag.Var(&rejectStatuses, "reject-status", "Also skip rows with this Trade Status, ignoring case (repeatable)")
+	roundAmounts := flag.Bool("round-amounts", false, "Round sent, received and fee amounts to -fiat-precision or -crypto-precision decimals")
+	cryptoPrecision := flag.Int("crypto-precision", 8, "Decimals for crypto amounts under -round-amounts (-1 disables rounding)")
+	fiatPrecision := flag.Int("fiat-precision", 2, "Decimals for fiat values such as net worth (-1 disables rounding)")
+	mergeWindow := flag.Duration("merge-window", 0, "Pair orphan legs with nearly matching trade ids within this time gap (e.g. 5s)")
+	descLine := flag.Bool("desc-line", false, "Append the source K33 line numbers to each Description")
+	maxDescription := flag.Int("max-description", 0, "Truncate descriptions to this many characters (0 for no limit)")
+	var maxDescriptionTypes stringList
+	var descriptions stringList
+	flag.Var(&descriptions, "description", "Description template for a record type, as TYPE=TEMPLATE with {tradeID}, {asset}, {side} and {class} placeholders (repeatable)")
+	flag.Var(&maxDescriptionTypes, "max-description-type", "Per-type description limit, as TYPE=N for deposit, withdrawal, trade, fork, staking, reward, interest, adjustment or transfer (repeatable)")
+	currencies := flag.String("validate-currencies", "", "Warn about output currencies not listed in this file (one symbol per line)")
+	strictCurrencies := flag.Bool("strict-currencies", false, "With -validate-currencies, fail on unknown currencies instead of warning")
+	feeCurrency := flag.String("fee-currency", "sell", "Currency for trade fees exported without one: sell, buy, or a symbol")
+	netFee := flag.Bool("net-fee", false, "Subtract fees paid in the received currency from the received amount")
+	var assets stringList
+	flag.Var(&assets, "asset", "Only output records sending or receiving this asset (repeatable)")
+	var minFees stringList
+	var unitDivisors stringList
+	flag.Var(&unitDivisors, "unit-divisor", "Divide ASSET amounts by DIVISOR, as ASSET:DIVISOR (e.g. BTC:100000000 for satoshis; repeatable)")
+	flag.Var(&minFees, "min-fee", "Drop fees below AMOUNT or CURRENCY:AMOUNT (repeatable)")
+	var transforms stringList
+	flag.Var(&transforms, "transform", `Output column transform, e.g. "Sent Currency=upper" (repeatable)`)
 	flag.Parse()
 
-	in, err := os.Open(*inPath)
+	paths, err := inputPaths(*inPath)
 	if err != nil {
-		log.Fatalf("Failed to open input file: %v", err)
+		log.Fatal(err)
+	}
+	var ins []io.Reader
+	for _, path := range paths {
+		in, closeIn, err := openInput(path)
+		if err != nil {
+			log.Fatalf("Failed to open input file: %v", err)
+		}
+		defer closeIn()
+		ins = append(ins, in)
+	}
+
+	conv := converter.New()
+	switch {
+	case *verbose && *quiet:
+		log.Fatal("-v and -q cannot be combined")
+	case *verbose:
+		conv.LogLevel = converter.LogVerbose
+	case *quiet:
+		conv.LogLevel = converter.LogQuiet
+	}
+	conv.StrictDepositStatus = *strictDeposits
+	conv.SkipLines = *skipLines
+	conv.StartOffset = *offset
+	conv.AssertColumns = *assertColumns
+	conv.MergeWindow = *mergeWindow
+	conv.ZeroFillAmounts = *zeroFill
+	conv.Daily = *daily
+	if *tz != "" {
+		conv.Location = converter.LoadLocation(*tz)
+	}
+	conv.WithSeq = *withSeq
+	conv.BOM = *bom
+	if conv.InDelimiter, err = converter.ParseDelimiter(*inDelim); err != nil {
+		log.Fatalf("Invalid -in-delim: %v", err)
+	}
+	if conv.OutDelimiter, err = converter.ParseDelimiter(*outDelim); err != nil {
+		log.Fatalf("Invalid -out-delim: %v", err)
+	}
+	for _, path := range paths {
+		if conv.InDelimiter != ',' && strings.HasSuffix(strings.ToLower(path), ".xlsx") {
+			log.Fatalf("-in-delim does not apply to Excel input %s", path)
+		}
+	}
+	conv.FiatPrecision = *fiatPrecision
+	conv.RoundAmounts = *roundAmounts
+	conv.CryptoPrecision = *cryptoPrecision
+	conv.SkipDeposits = *noDeposits
+	conv.SkipWithdrawals = *noWithdrawals
+	conv.SkipTrades = *noTrades
+	switch f := converter.Format(*format); f {
+	case converter.FormatCSV, converter.FormatJSONL:
+		conv.Format = f
+	default:
+		log.Fatalf("Invalid -format %q: want csv or jsonl", *format)
+	}
+	switch t := converter.Target(*target); t {
+	case converter.TargetKoinly, converter.TargetCoinTracking:
+		conv.Target = t
+	default:
+		log.Fatalf("Invalid -target %q: want koinly or cointracking", *target)
+	}
+	switch order := converter.OutputOrder(*outputOrder); order {
+	case converter.OrderInput, converter.OrderDate, converter.OrderType:
+		conv.OutputOrder = order
+	default:
+		log.Fatalf("Invalid -output-order %q: want input, date, or type", *outputOrder)
+	}
+	if *sortByDate {
+		if conv.OutputOrder == converter.OrderType {
+			log.Fatal("-sort conflicts with -output-order type")
+		}
+		conv.OutputOrder = converter.OrderDate
+	}
+	conv.Reverse = *reverse
+	if *maxBuffer < 0 {
+		log.Fatalf("Invalid -max-buffer %d: must not be negative", *maxBuffer)
+	}
+	conv.MaxBuffer = *maxBuffer
+	conv.MaxErrors = *maxErrors
+	conv.Dedup = *dedup
+	conv.InternalTransfers = *internalTransfers
+	switch policy := converter.ZeroLegPolicy(*zeroLegPolicy); policy {
+	case converter.ZeroLegEmit, converter.ZeroLegSkip, converter.ZeroLegTransfer:
+		conv.ZeroLegPolicy = policy
+	default:
+		log.Fatalf("Invalid -zero-leg-policy %q: want emit, skip, or transfer", *zeroLegPolicy)
+	}
+	switch sc := converter.SignConvention(*signConvention); sc {
+	case converter.SignOpposite, converter.SignNegative, converter.SignAny:
+		conv.SignConvention = sc
+	default:
+		log.Fatalf("Invalid -sign-convention %q: want opposite, negative, or any", *signConvention)
+	}
+	switch basis := converter.AmountBasis(*amountBasis); basis {
+	case converter.AmountBasisNet, converter.AmountBasisGross:
+		conv.AmountBasis = basis
+	default:
+		log.Fatalf("Invalid -amount-basis %q: want net or gross", *amountBasis)
+	}
+	switch tt := converter.TradeTime(*tradeTime); tt {
+	case converter.TradeTimeFirst, converter.TradeTimeBuy, converter.TradeTimeSell,
+		converter.TradeTimeEarliest, converter.TradeTimeLatest:
+		conv.TradeTime = tt
+	default:
+		log.Fatalf("Invalid -trade-time %q: want first, buy, sell, earliest, or latest", *tradeTime)
+	}
+	if *since != "" {
+		d, err := converter.ParseDuration(*since)
+		if err != nil {
+			log.Fatalf("Invalid -since: %v", err)
+		}
+		conv.Since = d
+	}
+	conv.From = parseDateFlag("from", *from)
+	conv.To = parseDateFlag("to", *to)
+	if !conv.From.IsZero() && !conv.To.IsZero() && conv.To.Before(conv.From) {
+		log.Fatalf("Invalid date range: -to %s is before -from %s", *to, *from)
+	}
+
+	for _, spec := range columns {
+		canonical, source, ok := strings.Cut(spec, "=")
+		if !ok || canonical == "" || source == "" {
+			log.Fatalf("Invalid -column %q: want K33NAME=EXPORTNAME", spec)
+		}
+		if conv.Columns == nil {
+			conv.Columns = make(map[string]string)
+		}
+		conv.Columns[canonical] = source
+	}
+	if *fiatValueColumn != "Fiat Value" {
+		if conv.Columns == nil {
+			conv.Columns = make(map[string]string)
+		}
+		conv.Columns["Fiat Value"] = *fiatValueColumn
+	}
+	conv.FiatValueCurrency = strings.ToUpper(*fiatValueCurrency)
+	for _, spec := range directionValues {
+		value, dir, ok := strings.Cut(spec, "=")
+		if !ok || (dir != "in" && dir != "out") {
+			log.Fatalf("Invalid -direction-value %q: want VALUE=in or VALUE=out", spec)
+		}
+		if conv.DirectionValues == nil {
+			conv.DirectionValues = converter.DefaultDirectionValues()
+		}
+		conv.DirectionValues[strings.ToLower(value)] = dir
+	}
+	conv.InferTypeFromSign = *inferTypeFromSign
+	for _, code := range fiat {
+		if conv.FiatCurrencies == nil {
+			conv.FiatCurrencies = converter.DefaultFiatCurrencies()
+		}
+		conv.FiatCurrencies[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	for _, status := range rejectStatuses {
+		if conv.RejectStatuses == nil {
+			conv.RejectStatuses = converter.DefaultRejectStatuses()
+		}
+		conv.RejectStatuses[strings.ToLower(strings.TrimSpace(status))] = true
+	}
+
+	conv.DescLine = *descLine
+	conv.MaxDescription = *maxDescription
+	for _, spec := range maxDescriptionTypes {
+		kind, limit, ok := strings.Cut(spec, "=")
+		n, err := strconv.Atoi(limit)
+		if !ok || err != nil || n < 0 {
+			log.Fatalf("Invalid -max-description-type %q: want TYPE=N", spec)
+		}
+		if conv.MaxDescriptionByType == nil {
+			conv.MaxDescriptionByType = make(map[string]int)
+		}
+		conv.MaxDescriptionByType[strings.ToLower(kind)] = n
+	}
+
+	for _, spec := range descriptions {
+		kind, template, ok := strings.Cut(spec, "=")
+		if !ok {
+			log.Fatalf("Invalid -description %q: want TYPE=TEMPLATE", spec)
+		}
+		if conv.Descriptions == nil {
+			conv.Descriptions = make(map[string]string)
+		}
+		conv.Descriptions[strings.ToLower(kind)] = template
+	}
+
+	conv.Tag = *tag
+	for _, spec := range assetTags {
+		asset, value, ok := strings.Cut(spec, "=")
+		if !ok || asset == "" {
+			log.Fatalf("Invalid -tag-asset %q: want ASSET=TAG", spec)
+		}
+		if conv.TagsByAsset == nil {
+			conv.TagsByAsset = make(map[string]string)
+		}
+		conv.TagsByAsset[strings.ToUpper(asset)] = value
+	}
+
+	for _, asset := range assets {
+		if conv.Assets == nil {
+			conv.Assets = make(map[string]bool)
+		}
+		conv.Assets[strings.ToUpper(asset)] = true
+	}
+
+	conv.NetFee = *netFee
+	conv.FeeCurrency = *feeCurrency
+	if *feeCurrency != converter.FeeCurrencySell && *feeCurrency != converter.FeeCurrencyBuy {
+		conv.FeeCurrency = strings.ToUpper(*feeCurrency)
+	}
+	for _, spec := range minFees {
+		currency, min, err := converter.ParseMinFee(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if conv.MinFee == nil {
+			conv.MinFee = make(map[string]*big.Rat)
+		}
+		conv.MinFee[currency] = min
+	}
+	for _, spec := range unitDivisors {
+		asset, divisor, err := converter.ParseUnitDivisor(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if conv.UnitDivisors == nil {
+			conv.UnitDivisors = make(map[string]*big.Rat)
+		}
+		conv.UnitDivisors[asset] = divisor
+	}
+
+	for _, spec := range transforms {
+		column, transform, err := converter.ParseColumnTransform(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if conv.Transforms == nil {
+			conv.Transforms = make(map[string]converter.Transform)
+		}
+		conv.Transforms[column] = transform
+	}
+	if err := conv.CheckTransforms(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *pricesPath != "" {
+		f, err := os.Open(*pricesPath)
+		if err != nil {
+			log.Fatalf("Failed to open prices file: %v", err)
+		}
+		conv.Prices, err = converter.LoadPrices(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *baseFiat != "" {
+		if *fiatRatesPath == "" {
+			log.Fatal("-map-fiat-to-base requires -fiat-rates")
+		}
+		f, err := os.Open(*fiatRatesPath)
+		if err != nil {
+			log.Fatalf("Failed to open fiat rates file: %v", err)
+		}
+		conv.FiatRates, err = converter.LoadFiatRates(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		conv.BaseFiat = strings.ToUpper(*baseFiat)
+	}
+
+	if *currencies != "" {
+		conv.Currencies, err = converter.LoadCurrencyRegistry(*currencies)
+		if err != nil {
+			log.Fatal(err)
+		}
+		conv.StrictCurrencies = *strictCurrencies
+	}
+
+	if *pendingIn != "" {
+		f, err := os.Open(*pendingIn)
+		if err != nil {
+			log.Fatalf("Failed to open pending file: %v", err)
+		}
+		err = conv.LoadPending(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *pendingOut != "" {
+		w, closeFn, err := createReport(*pendingOut)
+		if err != nil {
+			log.Fatalf("Failed to create pending file: %v", err)
+		}
+		defer closeFn()
+		conv.PendingOut = w
+	}
+
+	if *feeReport != "" {
+		w, closeFn, err := createReport(*feeReport)
+		if err != nil {
+			log.Fatalf("Failed to create fee report: %v", err)
+		}
+		defer closeFn()
+		conv.FeeReport = w
+	}
+
+	if *dailySummary != "" {
+		w, closeFn, err := createReport(*dailySummary)
+		if err != nil {
+			log.Fatalf("Failed to create daily summary: %v", err)
+		}
+		defer closeFn()
+		conv.DailySummary = w
+	}
+
+	if *humanOut != "" {
+		w, closeFn, err := createReport(*humanOut)
+		if err != nil {
+			log.Fatalf("Failed to create human-readable output: %v", err)
+		}
+		defer closeFn()
+		conv.HumanOut = w
+	}
+
+	conv.Strict = *strict
+	conv.NoTrim = *noTrim
+	if *explainUnpaired {
+		conv.ExplainUnpaired = os.Stderr
+	}
+	if *verboseStats {
+		conv.VerboseStats = os.Stderr
+	}
+
+	if *rejectsReport != "" {
+		w, closeFn, err := createReport(*rejectsReport)
+		if err != nil {
+			log.Fatalf("Failed to create rejects report: %v", err)
+		}
+		defer closeFn()
+		conv.RejectsReport = w
+	}
+
+	if *unrecognizedReport != "" {
+		w, closeFn, err := createReport(*unrecognizedReport)
+		if err != nil {
+			log.Fatalf("Failed to create unrecognized report: %v", err)
+		}
+		defer closeFn()
+		conv.UnrecognizedReport = w
 	}
-	defer in.Close()
 
 	if *dryrun {
-		conv := converter.New()
-		if err := conv.ProcessDryRun(in, os.Stdout); err != nil {
+		conv.Color = !*noColor && isTerminal(os.Stdout)
+		if err := conv.ProcessDryRunAll(ins, os.Stdout); err != nil {
 			log.Fatal(err)
 		}
-		return
+		if !*quiet {
+			log.Printf("Summary: %v", conv.Stats())
+		}
+		return warningStatus(conv, *noFailOnWarn)
 	}
 
-	out, err := os.Create(*outPath)
+	if *manifest && *outPath == "-" {
+		log.Fatal("-manifest needs an -out file")
+	}
+	if *outPath != "-" {
+		// Stdin holding the input cannot also answer the prompt
+		interactive := *inPath != "-" && isTerminal(os.Stdin) && isTerminal(os.Stdout)
+		if err := checkOverwrite(*outPath, *force, interactive, os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	out, closeOut, err := createOutput(*outPath, *gzipOut)
 	if err != nil {
 		log.Fatalf("Failed to create output file: %v", err)
 	}
-	defer out.Close()
 
-	conv := converter.New()
-	if err := conv.Process(in, out); err != nil {
+	if *teeJSON {
+		conv.TeeJSON = os.Stdout
+		if *outPath == "-" {
+			conv.TeeJSON = os.Stderr
+		}
+	}
+	if err := conv.ProcessAll(ins, out); err != nil {
 		log.Fatal(err)
 	}
+	if err := closeOut(); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+	if *manifest {
+		if err := writeManifest(conv, *outPath); err != nil {
+			log.Fatalf("Failed to write manifest: %v", err)
+		}
+	}
+
+	if !*quiet {
+		log.Printf("Successfully converted %s to %s", *inPath, *outPath)
+		log.Printf("Summary: %v", conv.Stats())
+	}
+	return warningStatus(conv, *noFailOnWarn)
+}
+
+// warningStatus is the exit status of a conversion that succeeded: 2 when
+// it raised warnings and ignore is unset, so CI runs fail loudly, else 0.
+func warningStatus(conv *converter.Converter, ignore bool) int {
+	n := conv.Warnings()
+	if n == 0 || ignore {
+		return 0
+	}
+	log.Printf("%d warnings; exiting with status 2 (pass -no-fail-on-warn to ignore)", n)
+	return 2
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// checkOverwrite decides whether path may be written. An existing file is
+// only replaced with force, or after the user confirms on a terminal.
+func checkOverwrite(path string, force, interactive bool, in io.Reader, out io.Writer) error {
+	if force {
+		return nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if !interactive {
+		return fmt.Errorf("output file %s already exists: use -force to overwrite", path)
+	}
+
+	fmt.Fprintf(out, "Overwrite %s? [y/N] ", path)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("not overwriting %s", path)
+}
+
+// parseDateFlag parses a YYYY-MM-DD flag value, exiting on a bad date. An
+// empty value gives the zero time.
+func parseDateFlag(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	d, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		log.Fatalf("Invalid -%s %q: want YYYY-MM-DD", name, value)
+	}
+	return d
+}
+
+// createReport opens a side-report destination, where "-" means stdout.
+func createReport(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// inputPaths expands the -in value into the files to convert, in order:
+// a comma-separated list whose entries may be globs, each glob's matches
+// sorted by name.
+func inputPaths(spec string) ([]string, error) {
+	var paths []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.ContainsAny(entry, "*?[") {
+			paths = append(paths, entry)
+			continue
+		}
+		matches, err := filepath.Glob(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -in pattern %q: %w", entry, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input files match %q", entry)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no input files given")
+	}
+	if len(paths) > 1 && slices.Contains(paths, "-") {
+		return nil, errors.New("stdin (-) cannot be combined with other inputs")
+	}
+	return paths, nil
+}
+
+// openInput opens the K33 export at path, where "-" means stdin. Excel
+// workbooks (.xlsx) are read into CSV up front, so they go through the same
+// pipeline as CSV exports. Gzip-compressed files (.csv.gz) are detected by
+// their magic bytes and decompressed as they are read.
+func openInput(path string) (io.Reader, func() error, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".xlsx") {
+		in, err := converter.ReadXLSX(path)
+		return in, func() error { return nil }, err
+	}
+	f, closeFn := os.Stdin, func() error { return nil }
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, nil, err
+		}
+		closeFn = f.Close
+	}
+
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, closeFn, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		closeFn()
+		return nil, nil, fmt.Errorf("reading gzip input: %w", err)
+	}
+	return zr, func() error {
+		zr.Close()
+		return closeFn()
+	}, nil
+}
+
+// createOutput opens the converted CSV destination, where "-" means stdout.
+// Paths ending in .gz, or gz set, get a gzip writer; the returned close
+// function flushes the gzip trailer before closing the file.
+func createOutput(path string, gz bool) (io.Writer, func() error, error) {
+	w, closeFn, err := createReport(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !gz && !strings.HasSuffix(strings.ToLower(path), ".gz") {
+		return w, closeFn, nil
+	}
+	zw := gzip.NewWriter(w)
+	return zw, func() error {
+		if err := zw.Close(); err != nil {
+			closeFn()
+			return err
+		}
+		return closeFn()
+	}, nil
+}
+
+// writeManifest writes the manifest of the output at outPath to
+// outPath.manifest.json, recording the flags set on the command line.
+func writeManifest(conv *converter.Converter, outPath string) error {
+	params := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		params[f.Name] = f.Value.String()
+	})
+	m, err := conv.Manifest(outPath, params)
+	if err != nil {
+		return err
+	}
+	w, closeFn, err := createReport(outPath + ".manifest.json")
+	if err != nil {
+		return err
+	}
+	if err := m.Write(w); err != nil {
+		closeFn()
+		return err
+	}
+	return closeFn()
+}
 
-	log.Printf("Successfully converted %s to %s", *inPath, *outPath)
-}
\ No newline at end of file
+// isTerminal reports whether f is attached to a character device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"k33-to-koinly/converter"
+)
+
+func TestCheckOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "koinly.csv")
+	if err := os.WriteFile(existing, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		force       bool
+		interactive bool
+		answer      string
+		wantErr     bool
+	}{
+		{"new file", filepath.Join(dir, "new.csv"), false, false, "", false},
+		{"non-tty refuses without force", existing, false, false, "", true},
+		{"non-tty with force", existing, true, false, "", false},
+		{"tty confirmed", existing, false, true, "y\n", false},
+		{"tty declined", existing, false, true, "n\n", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkOverwrite(test.path, test.force, test.interactive, strings.NewReader(test.answer), &strings.Builder{})
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkOverwrite() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if data, _ := os.ReadFile(existing); string(data) != "old" {
+		t.Errorf("checkOverwrite modified the existing file: %q", data)
+	}
+}
+
+func TestCreateOutputGzip(t *testing.T) {
+	const input = `Type/Status,TradeID,Side,Amount,Trade Status,Asset,Timestamp (UTC),UniqueKey,DepositTxhash,WithdrawalTxhash
+Deposit Complete,,,0.5,,BTC,2023/01/15 10:00:00,k1,abc,
+`
+	var want strings.Builder
+	if err := converter.New().Process(strings.NewReader(input), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "koinly.csv.gz")
+	out, closeOut, err := createOutput(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := converter.New().Process(strings.NewReader(input), out); err != nil {
+		t.Fatal(err)
+	}
+	if err := closeOut(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("output is not gzip: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip output: %v", err)
+	}
+	if string(got) != want.String() {
+		t.Errorf("decompressed output = %q, want %q", got, want.String())
+	}
+}
+
+func TestOpenInputGzip(t *testing.T) {
+	const input = "Type/Status,Amount,Asset,Timestamp (UTC)\nDeposit Complete,0.5,BTC,2023/01/15 10:00:00\n"
+	dir := t.TempDir()
+
+	gzPath := filepath.Join(dir, "k33.csv.gz")
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(input))
+	zw.Close()
+	if err := os.WriteFile(gzPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plainPath := filepath.Join(dir, "k33.csv")
+	if err := os.WriteFile(plainPath, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{gzPath, plainPath} {
+		in, closeIn, err := openInput(path)
+		if err != nil {
+			t.Fatalf("openInput(%s) failed: %v", path, err)
+		}
+		got, err := io.ReadAll(in)
+		closeIn()
+		if err != nil {
+			t.Fatalf("reading %s failed: %v", path, err)
+		}
+		if string(got) != input {
+			t.Errorf("openInput(%s) read %q, want %q", path, got, input)
+		}
+	}
+}
+
+func TestInputPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2023-02.csv", "2023-01.csv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := inputPaths("extra.csv, " + filepath.Join(dir, "*.csv"))
+	if err != nil {
+		t.Fatalf("inputPaths failed: %v", err)
+	}
+	want := []string{"extra.csv", filepath.Join(dir, "2023-01.csv"), filepath.Join(dir, "2023-02.csv")}
+	if !slices.Equal(got, want) {
+		t.Errorf("inputPaths = %v, want %v", got, want)
+	}
+	if _, err := inputPaths(filepath.Join(dir, "*.xlsx")); err == nil {
+		t.Error("want an error for a glob matching nothing")
+	}
+}
+
+func TestStdinInput(t *testing.T) {
+	if got, err := inputPaths("-"); err != nil || !slices.Equal(got, []string{"-"}) {
+		t.Errorf(`inputPaths("-") = %v, %v, want stdin alone`, got, err)
+	}
+	if _, err := inputPaths("-,k33.csv"); err == nil {
+		t.Error("want an error for stdin combined with a file")
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("Type/Status,Amount,Asset,Timestamp (UTC)\n")
+	f.Seek(0, io.SeekStart)
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	in, closeIn, err := openInput("-")
+	if err != nil {
+		t.Fatalf("openInput failed: %v", err)
+	}
+	data, _ := io.ReadAll(in)
+	if !strings.HasPrefix(string(data), "Type/Status,") {
+		t.Errorf("read %q from stdin", data)
+	}
+	if err := closeIn(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, err := f.Stat(); err != nil {
+		t.Errorf("closing the input closed stdin: %v", err)
+	}
+}
+
+func TestWarningStatus(t *testing.T) {
+	conv := converter.New()
+	conv.LogLevel = converter.LogQuiet
+	input := "Type/Status,Amount,Asset,Timestamp (UTC)\nDeposit Complete,n/a,USD,2023/01/15 10:30:45\nDeposit Complete,100,USD,2023/01/15 10:31:45"
+	if err := conv.Process(strings.NewReader(input), io.Discard); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if got := warningStatus(conv, false); got != 2 {
+		t.Errorf("warningStatus = %d, want 2 after a warning", got)
+	}
+	if got := warningStatus(conv, true); got != 0 {
+		t.Errorf("warningStatus with -no-fail-on-warn = %d, want 0", got)
+	}
+}
+
+func TestWarningStatusEmptyTimestamp(t *testing.T) {
+	conv := converter.New()
+	conv.LogLevel = converter.LogQuiet
+	input := "Type/Status,Amount,Asset,Timestamp (UTC)\nDeposit Complete,100,USD,2023/01/15 10:31:45\nDeposit Complete,50,USD,"
+	if err := conv.Process(strings.NewReader(input), io.Discard); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if got := warningStatus(conv, false); got != 2 {
+		t.Errorf("warningStatus = %d, want 2 for a row skipped with an empty timestamp", got)
+	}
+}